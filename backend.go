@@ -0,0 +1,279 @@
+package dcap
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sort"
+	"time"
+)
+
+// Capturer read pixels of the virtual desktop
+type Capturer interface {
+	CaptureInto(dst image.Image, rect image.Rectangle) error
+}
+
+// InputInjector synthesize mouse and keyboard input
+type InputInjector interface {
+	MouseMove(x, y int) error
+	ToggleMouse(button MouseButton, down bool) error
+	ToggleKey(key string, down bool) error
+	Scroll(x, y int)
+}
+
+// ClipboardProvider read, write and watch the clipboard
+type ClipboardProvider interface {
+	ClipboardSet(text string) error
+	ClipboardGet() (string, error)
+	ClipboardTargets() ([]string, error)
+	ClipboardSetData(items map[string][]byte) error
+	ClipboardGetData(mime string) ([]byte, error)
+	WatchClipboard(ctx context.Context, sels ...Selection) (<-chan ClipboardEvent, error)
+}
+
+// DisplayProvider describe the displays and report their changes
+type DisplayProvider interface {
+	DisplayInfo() []Display
+	CurrentDisplays() []image.Rectangle
+	Events() <-chan Event
+}
+
+var (
+	_ Capturer          = (*DCap)(nil)
+	_ InputInjector     = (*DCap)(nil)
+	_ ClipboardProvider = (*DCap)(nil)
+	_ DisplayProvider   = (*DCap)(nil)
+)
+
+// names of the backends, Backends lists the ones of the running system
+const (
+	// BackendX11Shm X11 capture through MIT-SHM, input through XTest
+	BackendX11Shm = "x11-shm"
+	// BackendX11GetImage X11 capture through GetImage requests, works over
+	// the network
+	BackendX11GetImage = "x11-getimage"
+	// BackendFramebuffer capture of the Linux framebuffer device, without
+	// input
+	BackendFramebuffer = "framebuffer"
+	// BackendGDI capture and input of Windows
+	BackendGDI = "gdi"
+	// BackendQuartz capture and input of macOS
+	BackendQuartz = "quartz"
+	// BackendHeadless in memory screen and input, see Headless
+	BackendHeadless = "headless"
+)
+
+// backend implementation behind a DCap other than the native one of the
+// system, DCap handles locking and coordinates
+type backend interface {
+	// displays return the displays, the primary one first at the origin
+	displays() ([]Display, error)
+	// captureRaw read rect and pass the pixels to fn with their offset
+	// from rect.Min
+	captureRaw(rect image.Rectangle, fn func(off image.Point, src pixels)) error
+	mouseMove(x, y int) error
+	toggleMouse(button MouseButton, down bool) error
+	toggleKey(key string, down bool) error
+	scroll(x, y int)
+	capabilities() Capabilities
+	// clipboard return the clipboard used instead of the one of the system
+	clipboard() clipboardBackend
+	close() error
+}
+
+// noClipboard clipboard of a backend without one
+type noClipboard struct {
+	backend string
+}
+
+func (c noClipboard) unsupported() error {
+	return fmt.Errorf("%w: clipboard with the %s backend", ErrUnsupported, c.backend)
+}
+
+func (c noClipboard) Set(sel Selection, text string) error {
+	return c.unsupported()
+}
+
+func (c noClipboard) Get(sel Selection) (string, error) {
+	return "", c.unsupported()
+}
+
+func (c noClipboard) SetImage(sel Selection, png []byte) error {
+	return c.unsupported()
+}
+
+func (c noClipboard) GetImage(sel Selection) ([]byte, error) {
+	return nil, c.unsupported()
+}
+
+func (c noClipboard) Targets(sel Selection) ([]string, error) {
+	return nil, c.unsupported()
+}
+
+func (c noClipboard) SetData(sel Selection, items map[string][]byte) error {
+	return c.unsupported()
+}
+
+func (c noClipboard) GetData(sel Selection, target string) ([]byte, error) {
+	return nil, c.unsupported()
+}
+
+func (c noClipboard) Watch(ctx context.Context, sels ...Selection) (<-chan ClipboardEvent, error) {
+	return nil, c.unsupported()
+}
+
+func (noClipboard) Acquire() {}
+
+func (noClipboard) Release(persist, detach bool) error {
+	return nil
+}
+
+func (noClipboard) Available() bool {
+	return false
+}
+
+// backends registry of the non native backends by name
+var backends = map[string]func(o *options) (backend, error){
+	BackendHeadless: newHeadless,
+}
+
+// options of NewDCapWithOptions
+type options struct {
+	backend  string
+	headless *Headless
+	// display, xauthority and screen select the X server, $DISPLAY and
+	// $XAUTHORITY by default
+	display    string
+	xauthority string
+	screen     *int
+	// reconnect longest wait between reconnection attempts, 0 to stay
+	// disconnected
+	reconnect time.Duration
+}
+
+// Option configure NewDCapWithOptions
+type Option func(o *options)
+
+// WithBackend select the backend by name, the native one of the system
+// by default
+func WithBackend(name string) Option {
+	return func(o *options) {
+		o.backend = name
+	}
+}
+
+// WithHeadless use h as the backend, tests set its screen and read the
+// injected input from it
+func WithHeadless(h *Headless) Option {
+	return func(o *options) {
+		o.backend = BackendHeadless
+		o.headless = h
+	}
+}
+
+// WithDisplay connect to the X display name instead of $DISPLAY, e.g. :3,
+// :3.1, host:0 or tcp/host:0, local displays are reached on their
+// abstract socket first
+func WithDisplay(name string) Option {
+	return func(o *options) {
+		o.display = name
+	}
+}
+
+// WithXauthority read the authorization of the display from path instead
+// of $XAUTHORITY
+func WithXauthority(path string) Option {
+	return func(o *options) {
+		o.xauthority = path
+	}
+}
+
+// WithScreen use X screen n as primary screen instead of the screen of the
+// display name, X11 only
+func WithScreen(n int) Option {
+	return func(o *options) {
+		o.screen = &n
+	}
+}
+
+// WithReconnect reconnect to the X server when the connection is lost,
+// waiting from 100ms up to maxDelay between attempts, X11 only. Events report
+// ConnectionLost and Reconnected, calls fail with ErrConnectionLost
+// meanwhile
+func WithReconnect(maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.reconnect = maxDelay
+	}
+}
+
+// Backends list the names of the backends available on the system, the
+// default one first
+func Backends() []string {
+	names := append([]string(nil), nativeBackends...)
+	var others []string
+	for name := range backends {
+		others = append(others, name)
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// NewDCap create new dcap with the native backend
+func NewDCap() (*DCap, error) {
+	return NewDCapWithOptions()
+}
+
+// NewDCapWithOptions create new dcap configured by opts
+func NewDCapWithOptions(opts ...Option) (*DCap, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	d, err := newDCap(&o)
+	if err != nil {
+		return nil, err
+	}
+	d.board.Acquire()
+	d.trackLeak()
+	return d, nil
+}
+
+// newDCap create the dcap of the backend named by o
+func newDCap(o *options) (*DCap, error) {
+	if o.backend == "" {
+		return newNativeDCap(o)
+	}
+	for _, name := range nativeBackends {
+		if name == o.backend {
+			return newNativeDCap(o)
+		}
+	}
+	newBackend, ok := backends[o.backend]
+	if !ok {
+		return nil, fmt.Errorf("%w: backend %s", ErrUnsupported, o.backend)
+	}
+	b, err := newBackend(o)
+	if err != nil {
+		return nil, err
+	}
+	return newBackendDCap(b)
+}
+
+// newBackendDCap create a dcap over b
+func newBackendDCap(b backend) (*DCap, error) {
+	displays, err := b.displays()
+	if err != nil {
+		_ = b.close()
+		return nil, err
+	}
+	d := emptyDCap()
+	d.backend = b
+	d.board = b.clipboard()
+	d.events = make(chan Event, eventBuffer)
+	d.displays = displays
+	d.Displays = make([]image.Rectangle, len(displays))
+	for i, display := range displays {
+		d.Displays[i] = display.Bounds
+	}
+	return d, nil
+}
@@ -0,0 +1,61 @@
+package dcap
+
+import (
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	names := Backends()
+	if len(names) == 0 || names[0] != nativeBackends[0] {
+		t.Fatalf("backends %v do not start with the native one", names)
+	}
+	found := false
+	for _, name := range names {
+		found = found || name == BackendHeadless
+	}
+	if !found {
+		t.Fatalf("backends %v miss %s", names, BackendHeadless)
+	}
+	if _, err := NewDCapWithOptions(WithBackend("nope")); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("unknown backend error %v", err)
+	}
+}
+
+func TestHeadlessBackend(t *testing.T) {
+	d, err := NewDCapWithOptions(WithBackend(BackendHeadless))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if len(d.Displays) != 1 || d.Displays[0] != image.Rect(0, 0, 1920, 1080) {
+		t.Fatalf("displays %v", d.Displays)
+	}
+	if err = d.Capture(0, 0, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	if d.Image().Pix[3] != 255 {
+		t.Fatal("capture not opaque")
+	}
+	frames, err := d.CaptureDisplays()
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("frames %d, error %v", len(frames), err)
+	}
+	if err = d.MouseMove(10, 20); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Capabilities().Capture {
+		t.Fatal("headless backend cannot capture")
+	}
+}
+
+func TestNoClipboard(t *testing.T) {
+	c := noClipboard{backend: "test"}
+	if c.Available() {
+		t.Fatal("clipboard available")
+	}
+	if err := c.Set(SelectionClipboard, "text"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("error %v, want %v", err, ErrUnsupported)
+	}
+}
@@ -0,0 +1,68 @@
+package dcap
+
+import (
+	"image"
+	"image/color"
+)
+
+// BGRA image in the pixel layout of X11 and Windows, 4 bytes per pixel in
+// B, G, R, A order, captured without any conversion
+type BGRA struct {
+	Pix    []uint8
+	Stride int
+	Rect   image.Rectangle
+}
+
+// NewBGRA create new BGRA image
+func NewBGRA(r image.Rectangle) *BGRA {
+	return &BGRA{
+		Pix:    make([]uint8, 4*r.Dx()*r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (p *BGRA) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (p *BGRA) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *BGRA) At(x, y int) color.Color {
+	if !(image.Point{X: x, Y: y}.In(p.Rect)) {
+		return color.RGBA{}
+	}
+	i := p.PixOffset(x, y)
+	return color.RGBA{R: p.Pix[i+2], G: p.Pix[i+1], B: p.Pix[i], A: p.Pix[i+3]}
+}
+
+func (p *BGRA) Set(x, y int, c color.Color) {
+	if !(image.Point{X: x, Y: y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	c1 := color.RGBAModel.Convert(c).(color.RGBA)
+	p.Pix[i], p.Pix[i+1], p.Pix[i+2], p.Pix[i+3] = c1.B, c1.G, c1.R, c1.A
+}
+
+// PixOffset return the index of the first element of Pix for pixel (x, y)
+func (p *BGRA) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+// SubImage return an image representing the portion r of p, sharing its
+// pixels
+func (p *BGRA) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &BGRA{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &BGRA{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
@@ -0,0 +1,17 @@
+package dcap
+
+// Capabilities features available on the running system
+type Capabilities struct {
+	// Capture screen capture
+	Capture bool
+	// Shm capture through shared memory
+	Shm bool
+	// Input mouse and keyboard injection
+	Input bool
+	// Cursor reading of the cursor image
+	Cursor bool
+	// Damage tracking of the damaged screen areas
+	Damage bool
+	// Clipboard reading and writing of the clipboard
+	Clipboard bool
+}
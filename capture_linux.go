@@ -0,0 +1,219 @@
+package dcap
+
+import (
+	"context"
+	"image"
+	"sync"
+	"time"
+
+	"github.com/diiyw/dcap/internal/xconn"
+	"github.com/gen2brain/shm"
+	"github.com/jezek/xgb"
+	mshm "github.com/jezek/xgb/shm"
+	"github.com/jezek/xgb/xproto"
+)
+
+// grabber read root windows over one connection, its shared memory
+// segment is kept between captures
+type grabber struct {
+	mu     semaphore
+	conn   *xgb.Conn
+	useShm bool
+
+	seg  mshm.Seg
+	data []byte
+}
+
+func newGrabber(conn *xgb.Conn, useShm bool) *grabber {
+	return &grabber{conn: conn, useShm: useShm}
+}
+
+// capture read rect of root clipped to whole and pass the pixels to fn with
+// their offset from rect.Min, and return when they were read. g is taken
+// unless ctx is done first
+func (g *grabber) capture(ctx context.Context, root xproto.Window, rect, whole image.Rectangle, fn func(off image.Point, src pixels)) (time.Time, error) {
+	if err := g.mu.lock(ctx); err != nil {
+		return time.Time{}, err
+	}
+	defer g.mu.Unlock()
+	intersect := whole.Intersect(rect)
+	if intersect.Empty() {
+		return time.Now(), nil
+	}
+	data, err := g.grab(root, intersect)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := time.Now()
+	fn(intersect.Min.Sub(rect.Min), pixels{pix: data, stride: intersect.Dx() * 4, size: intersect.Size()})
+	return t, nil
+}
+
+// grab read rect of root as rows of BGRA pixels, data is valid until the
+// next grab
+func (g *grabber) grab(root xproto.Window, rect image.Rectangle) ([]byte, error) {
+	if g.useShm {
+		size := rect.Dx() * rect.Dy() * 4
+		if len(g.data) < size {
+			g.release()
+			if err := g.attach(size); err != nil {
+				// the server may not share our memory, e.g. over TCP
+				g.useShm = false
+				return g.grab(root, rect)
+			}
+		}
+		_, err := mshm.GetImage(g.conn, xproto.Drawable(root),
+			int16(rect.Min.X), int16(rect.Min.Y),
+			uint16(rect.Dx()), uint16(rect.Dy()), 0xffffffff,
+			byte(xproto.ImageFormatZPixmap), g.seg, 0).Reply()
+		if err != nil {
+			return nil, err
+		}
+		return g.data[:size], nil
+	}
+	xImg, err := xproto.GetImage(g.conn, xproto.ImageFormatZPixmap, xproto.Drawable(root),
+		int16(rect.Min.X), int16(rect.Min.Y),
+		uint16(rect.Dx()), uint16(rect.Dy()), 0xffffffff).Reply()
+	if err != nil {
+		return nil, err
+	}
+	return xImg.Data, nil
+}
+
+// attach create a shared memory segment of size readable by us only and
+// attach it to the server. It is removed at once, the kernel frees it when
+// both sides detach, even if the process is killed
+func (g *grabber) attach(size int) error {
+	shmId, err := shm.Get(shm.IPC_PRIVATE, size, shm.IPC_CREAT|0600)
+	if err != nil {
+		return err
+	}
+	seg, err := mshm.NewSegId(g.conn)
+	if err != nil {
+		_ = shm.Rm(shmId)
+		return err
+	}
+	data, err := shm.At(shmId, 0, 0)
+	if err != nil {
+		_ = shm.Rm(shmId)
+		return err
+	}
+	if err = mshm.AttachChecked(g.conn, seg, uint32(shmId), false).Check(); err != nil {
+		_ = shm.Dt(data)
+		_ = shm.Rm(shmId)
+		return err
+	}
+	_ = shm.Rm(shmId)
+	g.seg, g.data = seg, data
+	return nil
+}
+
+// release free the shared memory segment
+func (g *grabber) release() {
+	if g.data == nil {
+		return
+	}
+	mshm.Detach(g.conn, g.seg)
+	_ = shm.Dt(g.data)
+	g.data = nil
+}
+
+// grabbers return n grabbers, the first one uses the main connection and
+// the others their own, opened on first use
+func (d *DCap) grabbers(n int) ([]*grabber, error) {
+	d.workersMu.Lock()
+	defer d.workersMu.Unlock()
+	// Close closes the workers under workersMu once d is marked closed
+	if err := d.checkOpen("capture"); err != nil {
+		return nil, err
+	}
+	for len(d.workers) < n-1 {
+		c, err := d.dial()
+		if err != nil {
+			return nil, xError("connect", err)
+		}
+		d.workers = append(d.workers, newGrabber(c, d.useShm && mshm.Init(c) == nil))
+	}
+	grabbers := make([]*grabber, n)
+	grabbers[0] = d.grabber
+	copy(grabbers[1:], d.workers)
+	return grabbers, nil
+}
+
+// CaptureDisplays capture displays concurrently, each over its own
+// connection, every display when no index is given
+func (d *DCap) CaptureDisplays(indices ...int) ([]Frame, error) {
+	return d.captureDisplaysContext(context.Background(), indices)
+}
+
+// captureDisplaysContext CaptureDisplays, each grabber is taken unless ctx
+// is done first
+func (d *DCap) captureDisplaysContext(ctx context.Context, indices []int) ([]Frame, error) {
+	if d.backend != nil {
+		return d.captureDisplaysSerial(ctx, indices)
+	}
+	frames, err := d.newFrames(indices)
+	if err != nil {
+		return nil, err
+	}
+	grabbers, err := d.grabbers(len(frames))
+	if err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	origin, screens := d.origin, d.screens
+	d.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(frames))
+	for i := range frames {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			frame := &frames[i]
+			// a display is on a single screen, read it from its root window
+			s := screens[0]
+			for _, screen := range screens {
+				if screen.num == frame.Display.Screen {
+					s = screen
+				}
+			}
+			rect := frame.Display.Bounds.Add(origin).Sub(s.bounds.Min)
+			frame.Time, errs[i] = grabbers[i].capture(ctx, s.root, rect, s.bounds.Sub(s.bounds.Min), func(off image.Point, src pixels) {
+				convertPixels(frame.Image, off, src)
+			})
+		}(i)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, xError("GetImage", err)
+		}
+	}
+	return frames, nil
+}
+
+// closeGrabbers release shared memory and close the worker connections
+func (d *state) closeGrabbers() {
+	d.workersMu.Lock()
+	defer d.workersMu.Unlock()
+	// a capture hung on the server holds its grabber until the socket is
+	// closed
+	for _, g := range d.workers {
+		xconn.Close(g.conn)
+	}
+	if d.grabber != nil {
+		d.grabber.mu.Lock()
+		d.grabber.release()
+		d.grabber.mu.Unlock()
+	}
+	for _, g := range d.workers {
+		g.mu.Lock()
+		g.release()
+		g.mu.Unlock()
+	}
+	d.workers = nil
+}
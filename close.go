@@ -0,0 +1,159 @@
+package dcap
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// leakReporter set by SetLeakReporter, nil when disabled
+var leakReporter atomic.Pointer[func(stack string)]
+
+// SetLeakReporter debug mode reporting the DCaps garbage collected without
+// Close: report receives the stack which created the DCap, whose
+// connections are closed afterwards, the keys and buttons held down stay
+// down and the clipboard is not persisted. It applies to the DCaps created
+// later, nil disables it
+func SetLeakReporter(report func(stack string)) {
+	if report == nil {
+		leakReporter.Store(nil)
+		return
+	}
+	leakReporter.Store(&report)
+}
+
+// trackLeak report d to the leak reporter if it is never closed
+func (d *DCap) trackLeak() {
+	report := leakReporter.Load()
+	if report == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	runtime.SetFinalizer(d, func(d *DCap) {
+		(*report)(stack)
+		d.abandon()
+	})
+}
+
+// abandon release the resources of d collected without Close, it does not
+// wait on the server which would block the finalizers
+func (d *DCap) abandon() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	go func() {
+		_ = d.board.Release(false, false)
+		_ = d.release()
+	}()
+}
+
+// heldInput buttons and keys left down, released by Close
+type heldInput struct {
+	buttons map[MouseButton]bool
+	keys    map[string]bool
+}
+
+// mouse record the state of button
+func (h *heldInput) mouse(button MouseButton, down bool) {
+	if h.buttons == nil {
+		h.buttons = make(map[MouseButton]bool)
+	}
+	if down {
+		h.buttons[button] = true
+	} else {
+		delete(h.buttons, button)
+	}
+}
+
+// key record the state of key
+func (h *heldInput) key(key string, down bool) {
+	if h.keys == nil {
+		h.keys = make(map[string]bool)
+	}
+	if down {
+		h.keys[key] = true
+	} else {
+		delete(h.keys, key)
+	}
+}
+
+// releaseInput release the buttons and keys still held down, d is already
+// marked closed so the toggles are made directly
+func (d *DCap) releaseInput() error {
+	d.inputMu.Lock()
+	defer d.inputMu.Unlock()
+	var buttons []MouseButton
+	for button := range d.held.buttons {
+		buttons = append(buttons, button)
+	}
+	var keys []string
+	for key := range d.held.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(buttons, func(i, j int) bool { return buttons[i] < buttons[j] })
+	sort.Strings(keys)
+
+	var errs []error
+	for _, button := range buttons {
+		err := d.toggleMouse(button, false)
+		if err == nil {
+			d.held.mouse(button, false)
+		}
+		errs = append(errs, err)
+	}
+	for _, key := range keys {
+		err := d.toggleKey(key, false)
+		if err == nil {
+			d.held.key(key, false)
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// isClosed report if Close has been called
+func (d *DCap) isClosed() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.closed
+}
+
+// checkOpen return an error of op wrapping ErrClosed once d is closed
+func (d *DCap) checkOpen(op string) error {
+	if d.isClosed() {
+		return &Error{Op: op, Err: ErrClosed}
+	}
+	return nil
+}
+
+// closeTimeout bound the release of the input held down by Close, a call
+// hung on the server holds inputMu until the connection is closed
+const closeTimeout = time.Second
+
+// shutdown mark d closed and release the held input and the clipboard, ok
+// is false when d was already closed
+func (d *DCap) shutdown() (ok bool, err error) {
+	d.mu.Lock()
+	closed := d.closed
+	d.closed = true
+	d.mu.Unlock()
+	if closed {
+		return false, nil
+	}
+	runtime.SetFinalizer(d, nil)
+	released := make(chan error, 1)
+	go func() {
+		released <- d.releaseInput()
+	}()
+	select {
+	case err = <-released:
+	case <-time.After(closeTimeout):
+		// it fails once the connection is closed
+		err = &Error{Op: "release input", Cause: context.DeadlineExceeded}
+	}
+	return true, errors.Join(err, d.releaseClipboard())
+}
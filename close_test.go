@@ -0,0 +1,113 @@
+package dcap
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCloseReleasesInput(t *testing.T) {
+	h := NewHeadless()
+	d, err := NewDCapWithOptions(WithHeadless(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ToggleMouse(MouseLeft, true); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ToggleKey("a", true); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ToggleKey("b", true); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ToggleKey("b", false); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if h.ButtonDown(MouseLeft) || h.KeyDown("a") {
+		t.Fatal("input still held after Close")
+	}
+	n := len(h.Log())
+	if err = d.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if len(h.Log()) != n {
+		t.Fatalf("second Close injected %v", h.Log()[n:])
+	}
+}
+
+func TestLeakReporter(t *testing.T) {
+	leaks := make(chan string, 1)
+	SetLeakReporter(func(stack string) {
+		leaks <- stack
+	})
+	defer SetLeakReporter(nil)
+
+	d, err := NewDCapWithOptions(WithBackend(BackendHeadless))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a closed DCap is not reported
+	runtime.GC()
+
+	func() {
+		_, err = NewDCapWithOptions(WithBackend(BackendHeadless))
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case stack := <-leaks:
+			if stack == "" {
+				t.Fatal("empty creation stack")
+			}
+			select {
+			case <-leaks:
+				t.Fatal("closed DCap reported")
+			default:
+			}
+			return
+		case <-timeout:
+			t.Fatal("leaked DCap not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestUseAfterClose(t *testing.T) {
+	d, err := NewDCapWithOptions(WithBackend(BackendHeadless))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Capture(0, 0, 10, 10); !errors.Is(err, ErrClosed) {
+		t.Fatalf("capture error %v", err)
+	}
+	if _, err = d.CaptureDisplays(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("capture displays error %v", err)
+	}
+	if err = d.MouseMove(1, 1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("mouse move error %v", err)
+	}
+	if err = d.ToggleKey("a", true); !errors.Is(err, ErrClosed) {
+		t.Fatalf("toggle key error %v", err)
+	}
+	if _, err = d.ClipboardGet(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("clipboard error %v", err)
+	}
+	if caps := d.Capabilities(); caps != (Capabilities{}) {
+		t.Fatalf("capabilities %+v", caps)
+	}
+}
@@ -0,0 +1,148 @@
+package dcap
+
+import (
+	"context"
+	"image"
+	"sync"
+)
+
+// semaphore mutex which can also be taken until a context is done, the
+// zero value is unlocked
+type semaphore struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func (s *semaphore) init() {
+	s.once.Do(func() {
+		s.ch = make(chan struct{}, 1)
+	})
+}
+
+// Lock lock s
+func (s *semaphore) Lock() {
+	s.init()
+	s.ch <- struct{}{}
+}
+
+// Unlock unlock s
+func (s *semaphore) Unlock() {
+	<-s.ch
+}
+
+// lock lock s unless ctx is done first, ctx is checked again once s is
+// taken so a call which waited past its deadline sends nothing
+func (s *semaphore) lock(ctx context.Context) error {
+	s.init()
+	select {
+	case s.ch <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		s.Unlock()
+		return err
+	}
+	return nil
+}
+
+// withContext run fn in its own goroutine and return its error, or the
+// error of ctx when it is done first. fn is left to finish in the
+// background, it gives up while waiting for its lock once ctx is done, a
+// request already sent returns once the server answers or Close closes the
+// connection
+func withContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CaptureContext Capture until ctx is done, a capture already sent to the
+// server still overwrites the image
+func (d *DCap) CaptureContext(ctx context.Context, x, y, width, height int) error {
+	return withContext(ctx, func() error {
+		return d.captureContext(ctx, x, y, width, height)
+	})
+}
+
+// CaptureDisplayContext CaptureDisplay until ctx is done, a capture already
+// sent to the server still overwrites the image
+func (d *DCap) CaptureDisplayContext(ctx context.Context, displayIndex int) error {
+	return withContext(ctx, func() error {
+		rect, err := d.displayBounds(displayIndex)
+		if err != nil {
+			return err
+		}
+		return d.captureContext(ctx, rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy())
+	})
+}
+
+// CaptureDisplaysContext CaptureDisplays until ctx is done, captures
+// already sent to the server still complete in the background
+func (d *DCap) CaptureDisplaysContext(ctx context.Context, indices ...int) ([]Frame, error) {
+	var frames []Frame
+	err := withContext(ctx, func() (err error) {
+		frames, err = d.captureDisplaysContext(ctx, indices)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// CaptureScaledContext CaptureScaled until ctx is done, a capture already
+// sent to the server still completes in the background
+func (d *DCap) CaptureScaledContext(ctx context.Context, rect image.Rectangle, width, height int, filter Filter) (*image.RGBA, error) {
+	var im *image.RGBA
+	err := withContext(ctx, func() (err error) {
+		im, err = d.captureScaledContext(ctx, rect, width, height, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return im, nil
+}
+
+// MouseMoveContext MouseMove until ctx is done, a move already sent to the
+// server may still take effect
+func (d *DCap) MouseMoveContext(ctx context.Context, x, y int) error {
+	return withContext(ctx, func() error {
+		return d.mouseMoveContext(ctx, x, y)
+	})
+}
+
+// ToggleMouseContext ToggleMouse until ctx is done, a button event already
+// sent to the server may still take effect
+func (d *DCap) ToggleMouseContext(ctx context.Context, button MouseButton, down bool) error {
+	return withContext(ctx, func() error {
+		return d.toggleMouseContext(ctx, button, down)
+	})
+}
+
+// ToggleKeyContext ToggleKey until ctx is done, a key event already sent to
+// the server may still take effect
+func (d *DCap) ToggleKeyContext(ctx context.Context, key string, down bool) error {
+	return withContext(ctx, func() error {
+		return d.toggleKeyContext(ctx, key, down)
+	})
+}
+
+// ScrollContext Scroll until ctx is done, scroll events already sent to the
+// server may still take effect
+func (d *DCap) ScrollContext(ctx context.Context, x, y int) error {
+	return withContext(ctx, func() error {
+		return d.scrollContext(ctx, x, y)
+	})
+}
@@ -0,0 +1,86 @@
+package dcap
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+func TestWithContext(t *testing.T) {
+	errTest := errors.New("test")
+	if err := withContext(context.Background(), func() error { return errTest }); err != errTest {
+		t.Fatalf("error %v, want %v", err, errTest)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	err := withContext(ctx, func() error {
+		<-release
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	called := false
+	if err = withContext(ctx, func() error { called = true; return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want %v", err, context.Canceled)
+	}
+	if called {
+		t.Fatal("fn called with a done context")
+	}
+}
+
+func TestContextStaleInput(t *testing.T) {
+	h := NewHeadless()
+	d, err := NewDCapWithOptions(WithHeadless(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	// the move waits for the lock past its deadline
+	d.inputMu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = d.MouseMoveContext(ctx, 10, 20); !errors.Is(err, context.DeadlineExceeded) {
+		d.inputMu.Unlock()
+		t.Fatalf("error %v, want %v", err, context.DeadlineExceeded)
+	}
+	d.inputMu.Unlock()
+
+	// taking the lock afterwards must not send the stale move
+	if err = d.MouseMove(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range h.Log() {
+		if ev.Point == image.Pt(10, 20) {
+			t.Fatalf("stale move sent: %v", h.Log())
+		}
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	var s semaphore
+	s.Lock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.lock(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want %v", err, context.Canceled)
+	}
+	s.Unlock()
+	// a done context fails even when the lock is free
+	if err := s.lock(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error %v, want %v", err, context.Canceled)
+	}
+	if err := s.lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.Unlock()
+}
@@ -0,0 +1,129 @@
+package dcap
+
+import (
+	"image"
+	"image/color"
+)
+
+// pixels rows of 32 bit pixels read from the screen, in BGRA order unless
+// rgba is set
+type pixels struct {
+	pix    []byte
+	stride int
+	size   image.Point
+	rgba   bool
+}
+
+// rgb return the colour of pixel x, y
+func (p pixels) rgb(x, y int) (r, g, b uint8) {
+	i := y*p.stride + x*4
+	if p.rgba {
+		return p.pix[i], p.pix[i+1], p.pix[i+2]
+	}
+	return p.pix[i+2], p.pix[i+1], p.pix[i]
+}
+
+// convertible report if CaptureInto supports dst
+func convertible(dst image.Image) bool {
+	switch dst := dst.(type) {
+	case *image.RGBA, *image.NRGBA, *image.Gray, *BGRA:
+		return true
+	case *image.YCbCr:
+		return dst.SubsampleRatio == image.YCbCrSubsampleRatio420 ||
+			dst.SubsampleRatio == image.YCbCrSubsampleRatio444
+	}
+	return false
+}
+
+// convertPixels write src to dst at dp in a single pass, alpha is set to
+// opaque, dst must be convertible
+func convertPixels(dst image.Image, dp image.Point, src pixels) {
+	switch dst := dst.(type) {
+	case *image.RGBA:
+		toRGBA(dst.Pix, dst.PixOffset(dp.X, dp.Y), dst.Stride, src)
+	case *image.NRGBA:
+		// opaque pixels are the same premultiplied or not
+		toRGBA(dst.Pix, dst.PixOffset(dp.X, dp.Y), dst.Stride, src)
+	case *BGRA:
+		toBGRA(dst, dp, src)
+	case *image.Gray:
+		toGray(dst, dp, src)
+	case *image.YCbCr:
+		toYCbCr(dst, dp, src)
+	}
+}
+
+func toRGBA(pix []byte, offset, stride int, src pixels) {
+	for y := 0; y < src.size.Y; y++ {
+		s := src.pix[y*src.stride : y*src.stride+src.size.X*4]
+		p := pix[offset+y*stride : offset+y*stride+src.size.X*4]
+		if src.rgba {
+			copy(p, s)
+			for x := 3; x < len(p); x += 4 {
+				p[x] = 255
+			}
+			continue
+		}
+		for x := 0; x < len(s); x += 4 {
+			p[x], p[x+1], p[x+2], p[x+3] = s[x+2], s[x+1], s[x], 255
+		}
+	}
+}
+
+func toBGRA(dst *BGRA, dp image.Point, src pixels) {
+	for y := 0; y < src.size.Y; y++ {
+		i := dst.PixOffset(dp.X, dp.Y+y)
+		for x := 0; x < src.size.X; x++ {
+			r, g, b := src.rgb(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = b, g, r, 255
+			i += 4
+		}
+	}
+}
+
+func toGray(dst *image.Gray, dp image.Point, src pixels) {
+	for y := 0; y < src.size.Y; y++ {
+		i := dst.PixOffset(dp.X, dp.Y+y)
+		for x := 0; x < src.size.X; x++ {
+			r, g, b := src.rgb(x, y)
+			// same weights as color.GrayModel
+			dst.Pix[i] = uint8((19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16)
+			i++
+		}
+	}
+}
+
+func toYCbCr(dst *image.YCbCr, dp image.Point, src pixels) {
+	for y := 0; y < src.size.Y; y++ {
+		i := dst.YOffset(dp.X, dp.Y+y)
+		for x := 0; x < src.size.X; x++ {
+			r, g, b := src.rgb(x, y)
+			yy, cb, cr := color.RGBToYCbCr(r, g, b)
+			dst.Y[i] = yy
+			if dst.SubsampleRatio == image.YCbCrSubsampleRatio444 {
+				c := dst.COffset(dp.X+x, dp.Y+y)
+				dst.Cb[c], dst.Cr[c] = cb, cr
+			}
+			i++
+		}
+	}
+	if dst.SubsampleRatio != image.YCbCrSubsampleRatio420 {
+		return
+	}
+	// a chroma sample is the average of its 2x2 pixels clipped to src,
+	// blocks start at even coordinates
+	for by := dp.Y &^ 1; by < dp.Y+src.size.Y; by += 2 {
+		for bx := dp.X &^ 1; bx < dp.X+src.size.X; bx += 2 {
+			var r, g, b, n int
+			for y := max(by, dp.Y); y < min(by+2, dp.Y+src.size.Y); y++ {
+				for x := max(bx, dp.X); x < min(bx+2, dp.X+src.size.X); x++ {
+					pr, pg, pb := src.rgb(x-dp.X, y-dp.Y)
+					r, g, b, n = r+int(pr), g+int(pg), b+int(pb), n+1
+				}
+			}
+			_, cb, cr := color.RGBToYCbCr(uint8(r/n), uint8(g/n), uint8(b/n))
+			c := dst.COffset(max(bx, dp.X), max(by, dp.Y))
+			dst.Cb[c], dst.Cr[c] = cb, cr
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package dcap
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testPixels 2x2 BGRA pixels in rows of 10 bytes
+var testPixels = pixels{
+	pix: []byte{
+		1, 2, 3, 0, 4, 5, 6, 0, 0xff, 0xff,
+		7, 8, 9, 0, 10, 11, 12, 0, 0xff, 0xff,
+	},
+	stride: 10,
+	size:   image.Pt(2, 2),
+}
+
+func TestConvertRGBA(t *testing.T) {
+	buf := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	dst := buf.SubImage(image.Rect(1, 1, 3, 3)).(*image.RGBA)
+	convertPixels(dst, dst.Rect.Min, testPixels)
+	if c := buf.RGBAAt(1, 1); c.R != 3 || c.G != 2 || c.B != 1 || c.A != 255 {
+		t.Fatalf("pixel 1,1 = %v", c)
+	}
+	if c := buf.RGBAAt(2, 2); c.R != 12 || c.G != 11 || c.B != 10 || c.A != 255 {
+		t.Fatalf("pixel 2,2 = %v", c)
+	}
+	if c := buf.RGBAAt(0, 0); c.A != 0 {
+		t.Fatal("pixel outside of the sub-image written")
+	}
+}
+
+func TestConvertFormats(t *testing.T) {
+	rect := image.Rect(0, 0, 2, 2)
+	want := []color.RGBA{{3, 2, 1, 255}, {6, 5, 4, 255}, {9, 8, 7, 255}, {12, 11, 10, 255}}
+	for _, dst := range []image.Image{
+		image.NewNRGBA(rect),
+		NewBGRA(rect),
+		image.NewGray(rect),
+		image.NewYCbCr(rect, image.YCbCrSubsampleRatio444),
+		image.NewYCbCr(rect, image.YCbCrSubsampleRatio420),
+	} {
+		if !convertible(dst) {
+			t.Fatalf("%T not convertible", dst)
+		}
+		convertPixels(dst, rect.Min, testPixels)
+		for i, c := range want {
+			x, y := i%2, i/2
+			var expect color.Color = c
+			switch dst := dst.(type) {
+			case *image.Gray:
+				expect = color.GrayModel.Convert(c)
+			case *image.YCbCr:
+				yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+				if dst.SubsampleRatio == image.YCbCrSubsampleRatio420 {
+					// the average of the four pixels
+					_, cb, cr = color.RGBToYCbCr(7, 6, 5)
+				}
+				expect = color.YCbCr{Y: yy, Cb: cb, Cr: cr}
+			}
+			r, g, b, a := dst.At(x, y).RGBA()
+			er, eg, eb, ea := expect.RGBA()
+			if r != er || g != eg || b != eb || a != ea {
+				t.Fatalf("%T pixel %d,%d = %v, want %v", dst, x, y, dst.At(x, y), expect)
+			}
+		}
+	}
+	if convertible(image.NewYCbCr(rect, image.YCbCrSubsampleRatio422)) {
+		t.Fatal("4:2:2 should not be convertible")
+	}
+}
+
+func TestConvertYCbCrOffset(t *testing.T) {
+	// a block split between two captures keeps the chroma of the last one
+	dst := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420)
+	convertPixels(dst, image.Pt(1, 1), testPixels)
+	_, cb, cr := color.RGBToYCbCr(3, 2, 1)
+	if c := dst.COffset(1, 1); dst.Cb[c] != cb || dst.Cr[c] != cr {
+		t.Fatalf("chroma 1,1 = %d,%d, want %d,%d", dst.Cb[c], dst.Cr[c], cb, cr)
+	}
+	_, cb, cr = color.RGBToYCbCr(12, 11, 10)
+	if c := dst.COffset(2, 2); dst.Cb[c] != cb || dst.Cr[c] != cr {
+		t.Fatalf("chroma 2,2 = %d,%d, want %d,%d", dst.Cb[c], dst.Cr[c], cb, cr)
+	}
+}
@@ -0,0 +1,53 @@
+package dcap
+
+import (
+	"fmt"
+	"image"
+)
+
+// Every method of DCap uses the coordinates of the virtual desktop: the
+// top-left corner of the primary display is (0, 0), x grows right and y
+// grows down, so displays left of or above the primary display have
+// negative coordinates. Displays, Capture and MouseMove all share it.
+
+// DisplayAt return index of the display containing p
+func (d *DCap) DisplayAt(p image.Point) (int, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for i, bounds := range d.Displays {
+		if p.In(bounds) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// ToDisplayLocal convert p of the virtual desktop to coordinates relative
+// to the top-left corner of display
+func (d *DCap) ToDisplayLocal(displayIndex int, p image.Point) (image.Point, error) {
+	bounds, err := d.displayBounds(displayIndex)
+	if err != nil {
+		return image.Point{}, err
+	}
+	return p.Sub(bounds.Min), nil
+}
+
+// ToGlobal convert p relative to the top-left corner of display to
+// coordinates of the virtual desktop
+func (d *DCap) ToGlobal(displayIndex int, p image.Point) (image.Point, error) {
+	bounds, err := d.displayBounds(displayIndex)
+	if err != nil {
+		return image.Point{}, err
+	}
+	return p.Add(bounds.Min), nil
+}
+
+// displayBounds return bounds of display
+func (d *DCap) displayBounds(displayIndex int) (image.Rectangle, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if displayIndex < 0 || len(d.Displays)-1 < displayIndex {
+		return image.Rectangle{}, fmt.Errorf("%w: index %d out of range", ErrDisplayNotFound, displayIndex)
+	}
+	return d.Displays[displayIndex], nil
+}
@@ -0,0 +1,48 @@
+package dcap
+
+import (
+	"image"
+	"testing"
+)
+
+func TestCoordinates(t *testing.T) {
+	// a display left of and above the primary one, and one on its right
+	d := emptyDCap()
+	d.Displays = []image.Rectangle{
+		image.Rect(0, 0, 1920, 1080),
+		image.Rect(-1280, -200, 0, 824),
+		image.Rect(1920, 0, 4480, 1440),
+	}
+	tests := []struct {
+		p       image.Point
+		display int
+		local   image.Point
+	}{
+		{image.Pt(0, 0), 0, image.Pt(0, 0)},
+		{image.Pt(1919, 1079), 0, image.Pt(1919, 1079)},
+		{image.Pt(-1, 0), 1, image.Pt(1279, 200)},
+		{image.Pt(-1280, -200), 1, image.Pt(0, 0)},
+		{image.Pt(1920, 1439), 2, image.Pt(0, 1439)},
+	}
+	for _, tt := range tests {
+		i, ok := d.DisplayAt(tt.p)
+		if !ok || i != tt.display {
+			t.Fatalf("DisplayAt(%v) = %d, want %d", tt.p, i, tt.display)
+		}
+		local, err := d.ToDisplayLocal(i, tt.p)
+		if err != nil || local != tt.local {
+			t.Fatalf("ToDisplayLocal(%d, %v) = %v, want %v", i, tt.p, local, tt.local)
+		}
+		global, err := d.ToGlobal(i, local)
+		if err != nil || global != tt.p {
+			t.Fatalf("ToGlobal(%d, %v) = %v, want %v", i, local, global, tt.p)
+		}
+	}
+	// gap below the left display
+	if i, ok := d.DisplayAt(image.Pt(-10, 1000)); ok {
+		t.Fatalf("DisplayAt in gap = %d", i)
+	}
+	if _, err := d.ToGlobal(3, image.Pt(0, 0)); err == nil {
+		t.Fatal("ToGlobal out of range")
+	}
+}
@@ -2,14 +2,72 @@ package dcap
 
 import "C"
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sync"
 
 	"github.com/diiyw/dcap/internal/clipboard"
 )
 
+// DCap capture the screen and inject input, it is safe for concurrent use
+// and capture does not wait for input or the other way around
+type DCap struct {
+	// state is shared with the event loop, which does not hold DCap so a
+	// DCap never closed can be collected, see SetLeakReporter
+	*state
+}
+
+// emptyDCap allocate a DCap and its state
+func emptyDCap() *DCap {
+	return &DCap{state: &state{common: common{board: clipboard.Board{}}}}
+}
+
+// common part of the state of every system
+type common struct {
+	im *image.RGBA
+	// Displays bounds of the displays, read them with CurrentDisplays while
+	// Events are handled
+	Displays []image.Rectangle
+	// displays description of Displays
+	displays []Display
+
+	// captureMu guard im and the capture state, inputMu the input state,
+	// so capture and input do not wait for each other
+	captureMu semaphore
+	inputMu   semaphore
+	// held input left down, guarded by inputMu
+	held heldInput
+
+	mu         sync.RWMutex
+	events     chan Event
+	background color.Color
+
+	clipboardPersistence ClipboardPersistence
+	// board clipboard of the display or of the backend
+	board clipboardBackend
+
+	// closed set by Close, nothing is opened again afterwards
+	closed bool
+
+	// backend replace the native capture and input when not nil
+	backend backend
+}
+
 // NewImage create new image
 func (d *DCap) NewImage(x, y, width, height int) {
+	d.captureMu.Lock()
+	d.newImage(width, height)
+	d.captureMu.Unlock()
+}
+
+// newImage replace im unless it is already width x height, d.captureMu
+// must be held
+func (d *DCap) newImage(width, height int) {
 	if d.im == nil {
 		d.im = image.NewRGBA(image.Rect(0, 0, width, height))
 	}
@@ -18,31 +76,317 @@ func (d *DCap) NewImage(x, y, width, height int) {
 	}
 }
 
+// Capture capture width x height at x, y of the virtual desktop into the
+// image of ImageNoCopy
+func (d *DCap) Capture(x, y, width, height int) error {
+	return d.captureContext(context.Background(), x, y, width, height)
+}
+
+// captureContext Capture once captureMu is taken, unless ctx is done first
+func (d *DCap) captureContext(ctx context.Context, x, y, width, height int) error {
+	if err := checkSize(width, height); err != nil {
+		return err
+	}
+	if err := d.captureMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.captureMu.Unlock()
+	return d.capture(image.Rect(x, y, x+width, y+height))
+}
+
+// checkSize fail with ErrInvalidSize unless width and height are positive,
+// every capture checks its size with it
+func checkSize(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("%w: capture size %dx%d", ErrInvalidSize, width, height)
+	}
+	return nil
+}
+
 func (d *DCap) CaptureDisplay(displayIndex int) error {
-	if len(d.Displays)-1 < displayIndex {
-		return fmt.Errorf("index %d out of range", displayIndex)
+	rect, err := d.displayBounds(displayIndex)
+	if err != nil {
+		return err
 	}
-	rect := d.Displays[displayIndex]
 	return d.Capture(rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy())
 }
 
+// Selection selection used by the clipboard methods, PRIMARY and SECONDARY
+// only exist on X11
+type Selection = clipboard.Selection
+
+const (
+	// SelectionClipboard selection used by copy and paste
+	SelectionClipboard = clipboard.Clipboard
+	// SelectionPrimary selection pasted with the middle button on X11
+	SelectionPrimary = clipboard.Primary
+	// SelectionSecondary secondary selection of X11
+	SelectionSecondary = clipboard.Secondary
+)
+
+// ClipboardEvent change of the clipboard owner, the new content is only
+// fetched by its Text and Data methods
+type ClipboardEvent = clipboard.Change
+
+// clipboardBackend clipboard behind the clipboard methods, the
+// clipboard.Board of the display or the clipboard of a backend
+type clipboardBackend interface {
+	Set(sel Selection, text string) error
+	Get(sel Selection) (string, error)
+	SetImage(sel Selection, png []byte) error
+	GetImage(sel Selection) ([]byte, error)
+	Targets(sel Selection) ([]string, error)
+	SetData(sel Selection, items map[string][]byte) error
+	GetData(sel Selection, target string) ([]byte, error)
+	Watch(ctx context.Context, sels ...Selection) (<-chan ClipboardEvent, error)
+	Acquire()
+	Release(persist, detach bool) error
+	Available() bool
+}
+
+// CaptureInto capture rect of the virtual desktop into dst without
+// allocating, rect.Min lands at dst.Bounds().Min and rect is clipped to the
+// size of dst, so a sub-image fills part of a larger buffer.
+// dst is *image.RGBA, *image.NRGBA, *image.Gray, *image.YCbCr with 4:2:0 or
+// 4:4:4 subsampling or *BGRA, pixels are converted from the native layout
+// in a single pass
+func (d *DCap) CaptureInto(dst image.Image, rect image.Rectangle) error {
+	if !convertible(dst) {
+		return fmt.Errorf("%w: image type %T", ErrUnsupported, dst)
+	}
+	if err := checkSize(rect.Dx(), rect.Dy()); err != nil {
+		return err
+	}
+	bounds := dst.Bounds()
+	if err := checkSize(bounds.Dx(), bounds.Dy()); err != nil {
+		return err
+	}
+	rect = rect.Intersect(image.Rectangle{Min: rect.Min, Max: rect.Min.Add(bounds.Size())})
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
+	return d.captureInto(dst, rect)
+}
+
+// captureInto convert rect of the virtual desktop into dst, rect.Min going
+// to dst.Bounds().Min, d.captureMu must be held
+func (d *DCap) captureInto(dst image.Image, rect image.Rectangle) error {
+	dp := dst.Bounds().Min
+	return d.captureRaw(rect, func(off image.Point, src pixels) {
+		convertPixels(dst, dp.Add(off), src)
+	})
+}
+
+// SetBackground set colour of the areas of CaptureAll covered by no
+// display, black by default
+func (d *DCap) SetBackground(c color.Color) {
+	d.mu.Lock()
+	d.background = c
+	d.mu.Unlock()
+}
+
+// CaptureAll capture every display into one image of their union, the
+// top-left corner of the union is the origin of the image, areas between
+// displays are filled with the background colour. regions maps display
+// index to its area in the image
+func (d *DCap) CaptureAll() (*image.RGBA, map[int]image.Rectangle, error) {
+	d.mu.RLock()
+	displays := make([]image.Rectangle, len(d.Displays))
+	copy(displays, d.Displays)
+	var background color.Color = color.Black
+	if d.background != nil {
+		background = d.background
+	}
+	d.mu.RUnlock()
+
+	var union image.Rectangle
+	for _, rect := range displays {
+		union = union.Union(rect)
+	}
+	im := image.NewRGBA(image.Rect(0, 0, union.Dx(), union.Dy()))
+	draw.Draw(im, im.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	regions := make(map[int]image.Rectangle, len(displays))
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
+	for i, rect := range displays {
+		region := rect.Sub(union.Min)
+		if err := d.captureInto(im.SubImage(region), rect); err != nil {
+			return nil, nil, err
+		}
+		regions[i] = region
+	}
+	return im, regions, nil
+}
+
+// ClipboardPersistence how data set to the clipboard survives Close
+type ClipboardPersistence byte
+
+const (
+	// PersistManager hand the clipboard to the clipboard manager on Close
+	PersistManager ClipboardPersistence = iota
+	// PersistDetach also keep the selections in a detached copy of the
+	// process when no clipboard manager is running, it exits once another
+	// client takes them. The process must call ServeDetachedClipboard
+	PersistDetach
+	// PersistNone let the clipboard go with the process
+	PersistNone
+)
+
+// ServeDetachedClipboard must be called first in main by the programs using
+// PersistDetach: in the copy of the process started by Close it serves the
+// clipboard and exits, elsewhere it returns at once
+func ServeDetachedClipboard() {
+	clipboard.ServeOwner()
+}
+
+// SetClipboardPersistence set how the clipboard survives Close, only X11
+// loses the clipboard with its owner. The clipboard is shared by the DCaps
+// of a display, the setting of the last one closed applies
+func (d *DCap) SetClipboardPersistence(p ClipboardPersistence) {
+	d.mu.Lock()
+	d.clipboardPersistence = p
+	d.mu.Unlock()
+}
+
+// releaseClipboard run on Close, the clipboard shared with the other DCaps
+// of the display is persisted and closed by the last one
+func (d *DCap) releaseClipboard() error {
+	d.mu.RLock()
+	p := d.clipboardPersistence
+	d.mu.RUnlock()
+	return clipboardError("release clipboard", d.board.Release(p != PersistNone, p == PersistDetach))
+}
+
 // ClipboardSet set text to clipboard
 func (d *DCap) ClipboardSet(text string) error {
-	return clipboard.Set(text)
+	return d.SelectionSet(SelectionClipboard, text)
 }
 
 // ClipboardGet get text from clipboard
 func (d *DCap) ClipboardGet() (string, error) {
-	return clipboard.Get()
+	return d.SelectionGet(SelectionClipboard)
+}
+
+// ClipboardTargets list the formats offered by the clipboard, MIME types
+// such as text/html or text/uri-list on Linux
+func (d *DCap) ClipboardTargets() ([]string, error) {
+	return d.SelectionTargets(SelectionClipboard)
+}
+
+// ClipboardSetData set several representations at once, keyed by MIME type
+func (d *DCap) ClipboardSetData(items map[string][]byte) error {
+	return d.SelectionSetData(SelectionClipboard, items)
+}
+
+// ClipboardGetData get clipboard data of MIME type
+func (d *DCap) ClipboardGetData(mime string) ([]byte, error) {
+	return d.SelectionGetData(SelectionClipboard, mime)
+}
+
+// ClipboardSetImage set image to clipboard as PNG
+func (d *DCap) ClipboardSetImage(im image.Image) error {
+	if err := d.checkOpen("set clipboard image"); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(&buf, im); err != nil {
+		return err
+	}
+	return clipboardError("set clipboard image", d.board.SetImage(SelectionClipboard, buf.Bytes()))
+}
+
+// ClipboardGetImage get PNG image from clipboard
+func (d *DCap) ClipboardGetImage() (image.Image, error) {
+	if err := d.checkOpen("get clipboard image"); err != nil {
+		return nil, err
+	}
+	data, err := d.board.GetImage(SelectionClipboard)
+	if err != nil {
+		return nil, clipboardError("get clipboard image", err)
+	}
+	return png.Decode(bytes.NewReader(data))
+}
+
+// WatchClipboard deliver an event whenever the owner of the clipboard, or of
+// the given selections, changes until ctx is done
+func (d *DCap) WatchClipboard(ctx context.Context, sels ...Selection) (<-chan ClipboardEvent, error) {
+	if err := d.checkOpen("watch clipboard"); err != nil {
+		return nil, err
+	}
+	if len(sels) == 0 {
+		sels = []Selection{SelectionClipboard}
+	}
+	ch, err := d.board.Watch(ctx, sels...)
+	if err != nil {
+		return nil, clipboardError("watch clipboard", err)
+	}
+	return ch, nil
+}
+
+// SelectionSet set text to selection
+func (d *DCap) SelectionSet(sel Selection, text string) error {
+	if err := d.checkOpen("set selection"); err != nil {
+		return err
+	}
+	return clipboardError("set selection", d.board.Set(sel, text))
+}
+
+// SelectionGet get text from selection
+func (d *DCap) SelectionGet(sel Selection) (string, error) {
+	if err := d.checkOpen("get selection"); err != nil {
+		return "", err
+	}
+	text, err := d.board.Get(sel)
+	if err != nil {
+		return "", clipboardError("get selection", err)
+	}
+	return text, nil
+}
+
+// SelectionTargets list the formats offered by selection
+func (d *DCap) SelectionTargets(sel Selection) ([]string, error) {
+	if err := d.checkOpen("get selection targets"); err != nil {
+		return nil, err
+	}
+	targets, err := d.board.Targets(sel)
+	if err != nil {
+		return nil, clipboardError("get selection targets", err)
+	}
+	return targets, nil
+}
+
+// SelectionSetData set several representations of selection, keyed by MIME type
+func (d *DCap) SelectionSetData(sel Selection, items map[string][]byte) error {
+	if err := d.checkOpen("set selection data"); err != nil {
+		return err
+	}
+	return clipboardError("set selection data", d.board.SetData(sel, items))
+}
+
+// SelectionGetData get selection data of MIME type
+func (d *DCap) SelectionGetData(sel Selection, mime string) ([]byte, error) {
+	if err := d.checkOpen("get selection data"); err != nil {
+		return nil, err
+	}
+	data, err := d.board.GetData(sel, mime)
+	if err != nil {
+		return nil, clipboardError("get selection data", err)
+	}
+	return data, nil
 }
 
-// ImageNoCopy return image.RGBA without copy
+// ImageNoCopy return image.RGBA without copy, it is overwritten by the next
+// Capture, use Image or CaptureInto when capturing from several goroutines
 func (d *DCap) ImageNoCopy() *image.RGBA {
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
 	return d.im
 }
 
 // Image return image.RGBA with copy
 func (d *DCap) Image() *image.RGBA {
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
 	im := image.NewRGBA(d.im.Bounds())
 	copy(im.Pix, d.im.Pix)
 	return im
@@ -29,61 +29,125 @@ void CompatCGContextDrawImage(CGContextRef c, CGRect rect, void* image) {
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"image"
 	"time"
 	"unsafe"
+
+	"github.com/diiyw/dcap/internal/keycode"
 )
 
-type DCap struct {
-	im                  *image.RGBA
-	Displays            []image.Rectangle
+// nativeBackends backends implemented by DCap itself
+var nativeBackends = []string{BackendQuartz}
+
+// state of DCap over Quartz
+type state struct {
+	common
+
 	displayIds          []C.CGDirectDisplayID
 	ctrlDown            bool
 	altDown             bool
 	shiftDown           bool
 	cmdDown             bool
-	currentDisplay      int
 	bitmapContext       C.CGContextRef
+	bitmapImage         *image.RGBA
+	bitmapSize          image.Point
 	colorSpace          C.CGColorSpaceRef
 	cgMainDisplayBounds C.CGRect
+	// scratch image drawn by captureRaw, it grows to the largest capture
+	// and is kept between captures
+	scratch *image.RGBA
 }
 
-// NewDCap create new dcap
-func NewDCap() (*DCap, error) {
-	var d = &DCap{}
+// newNativeDCap create new dcap over Quartz
+func newNativeDCap(o *options) (*DCap, error) {
+	var d = emptyDCap()
 	num := numActiveDisplays()
 	if num == 0 {
-		return nil, fmt.Errorf("can not get active displays")
+		return nil, fmt.Errorf("%w: no active display", ErrDisplayNotFound)
 	}
 	d.Displays = make([]image.Rectangle, num)
 	for i := 0; i < num; i++ {
 		d.Displays[i] = getDisplayBounds(i)
 	}
+	d.displays = displaysFromBounds(d.Displays)
 	d.displayIds = activeDisplayList()
 	d.cgMainDisplayBounds = C.CGRectMake(C.CGFloat(d.Displays[0].Min.X), C.CGFloat(d.Displays[0].Min.Y),
 		C.CGFloat(d.Displays[0].Dx()), C.CGFloat(d.Displays[0].Dy()))
 	return d, nil
 }
 
-func (d *DCap) Close() {
+// Capabilities report the features supported by the system, none after
+// Close
+func (d *DCap) Capabilities() Capabilities {
+	if d.isClosed() {
+		return Capabilities{}
+	}
+	if d.backend != nil {
+		return d.backend.capabilities()
+	}
+	return Capabilities{
+		Capture:   true,
+		Input:     true,
+		Cursor:    true,
+		Clipboard: true,
+	}
+}
+
+// Close release the keys and buttons held down and the colour space, later
+// calls do nothing
+func (d *DCap) Close() error {
+	ok, err := d.shutdown()
+	if !ok {
+		return nil
+	}
+	return errors.Join(err, d.release())
+}
+
+// release release the colour space of d marked closed
+func (d *DCap) release() error {
+	if d.backend != nil {
+		return d.backend.close()
+	}
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
 	C.CGColorSpaceRelease(d.colorSpace)
-	return
+	return nil
 }
 
-func (d *DCap) Capture(x, y, width, height int) error {
-	if width <= 0 || height <= 0 {
-		return errors.New("width or height should be > 0")
+// capture capture rect into im, Quartz draws it directly, d.captureMu must
+// be held
+func (d *DCap) capture(rect image.Rectangle) error {
+	d.newImage(rect.Dx(), rect.Dy())
+	if d.backend != nil {
+		return d.captureInto(d.im, rect)
+	}
+	if err := d.checkOpen("capture"); err != nil {
+		return err
 	}
-	d.NewImage(x, y, width, height)
+	return d.draw(d.im, rect)
+}
 
+// draw draw rect of the virtual desktop as RGBA into the top-left corner
+// of im, d.captureMu must be held
+func (d *DCap) draw(im *image.RGBA, rect image.Rectangle) error {
+	x, y, width, height := rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy()
 	winBottomLeft := C.CGPointMake(C.CGFloat(x), C.CGFloat(y+height))
 	cgBottomLeft := getCoreGraphicsCoordinateFromWindowsCoordinate(winBottomLeft, d.cgMainDisplayBounds)
 	cgCaptureBounds := C.CGRectMake(cgBottomLeft.x, cgBottomLeft.y, C.CGFloat(width), C.CGFloat(height))
 
+	// the context draws width x height into im, it is replaced when either
+	// changes
+	if d.bitmapContext != 0 && (d.bitmapImage != im || d.bitmapSize != rect.Size()) {
+		C.CGContextRelease(d.bitmapContext)
+		d.bitmapContext = 0
+	}
 	if d.bitmapContext == 0 {
-		d.bitmapContext = createBitmapContext(width, height, (*C.uint32_t)(unsafe.Pointer(&d.im.Pix[0])), d.im.Stride)
+		d.bitmapImage = im
+		d.bitmapSize = rect.Size()
+		d.bitmapContext = createBitmapContext(width, height, (*C.uint32_t)(unsafe.Pointer(&im.Pix[0])), im.Stride)
 		if d.bitmapContext == 0 {
 			return errors.New("cannot create bitmap context")
 		}
@@ -118,7 +182,8 @@ func (d *DCap) Capture(x, y, width, height int) error {
 			cgIntersect.size.width, cgIntersect.size.height)
 		captured := C.CompatCGDisplayCreateImageForRect(id, diIntersectDisplayLocal)
 		if captured == nil {
-			return errors.New("cannot capture display")
+			// no image without the screen recording permission
+			return &Error{Op: "CGDisplayCreateImageForRect", Err: ErrPermissionDenied}
 		}
 		defer C.CompatCGImageRelease(captured)
 
@@ -138,22 +203,76 @@ func (d *DCap) Capture(x, y, width, height int) error {
 		j := i
 		for ix := 0; ix < width; ix++ {
 			// ARGB => RGBA, and set A to 255
-			d.im.Pix[j], d.im.Pix[j+1], d.im.Pix[j+2], d.im.Pix[j+3] = d.im.Pix[j+1], d.im.Pix[j+2], d.im.Pix[j+3], 255
+			im.Pix[j], im.Pix[j+1], im.Pix[j+2], im.Pix[j+3] = im.Pix[j+1], im.Pix[j+2], im.Pix[j+3], 255
 			j += 4
 		}
-		i += d.im.Stride
+		i += im.Stride
 	}
 
 	return nil
 }
 
-// MouseMove move mouse to x,y
+// captureRaw read rect of the virtual desktop and pass the pixels to fn,
+// Quartz draws RGBA into the scratch image first, the image of Capture is
+// left alone
+func (d *DCap) captureRaw(rect image.Rectangle, fn func(off image.Point, src pixels)) error {
+	if err := d.checkOpen("capture"); err != nil {
+		return err
+	}
+	if d.backend != nil {
+		return d.backend.captureRaw(rect, fn)
+	}
+	size := rect.Size()
+	if d.scratch == nil || d.scratch.Rect.Dx() < size.X || d.scratch.Rect.Dy() < size.Y {
+		var old image.Point
+		if d.scratch != nil {
+			old = d.scratch.Rect.Size()
+		}
+		d.scratch = image.NewRGBA(image.Rect(0, 0, max(size.X, old.X), max(size.Y, old.Y)))
+	}
+	if err := d.draw(d.scratch, rect); err != nil {
+		return err
+	}
+	fn(image.Point{}, pixels{pix: d.scratch.Pix, stride: d.scratch.Stride, size: size, rgba: true})
+	return nil
+}
+
+// CaptureDisplays capture displays one after another, every display when
+// no index is given
+func (d *DCap) CaptureDisplays(indices ...int) ([]Frame, error) {
+	return d.captureDisplaysSerial(context.Background(), indices)
+}
+
+// captureDisplaysContext CaptureDisplays unless ctx is done first
+func (d *DCap) captureDisplaysContext(ctx context.Context, indices []int) ([]Frame, error) {
+	return d.captureDisplaysSerial(ctx, indices)
+}
+
+// MouseMove move mouse to x,y of the virtual desktop, the global display
+// coordinates of Quartz
 func (d *DCap) MouseMove(x, y int) error {
-	pt := C.CGPointMake(C.double(x), C.double(y))
-	err := C.CGDisplayMoveCursorToPoint(C.uint(d.currentDisplay), pt)
-	if err != 0 {
-		return fmt.Errorf("can not move: %d", err)
+	return d.mouseMoveContext(context.Background(), x, y)
+}
+
+// mouseMoveContext MouseMove once inputMu is taken, unless ctx is done first
+func (d *DCap) mouseMoveContext(ctx context.Context, x, y int) error {
+	if err := d.checkOpen("move mouse"); err != nil {
+		return err
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.inputMu.Unlock()
+	if d.backend != nil {
+		return d.backend.mouseMove(x, y)
 	}
+	pt := C.CGPointMake(C.CGFloat(x), C.CGFloat(y))
+	event := C.CGEventCreateMouseEvent(C.CGEventSourceRef(0), C.kCGEventMouseMoved, pt, C.kCGMouseButtonLeft)
+	if event == 0 {
+		return fmt.Errorf("can not move to %d,%d", x, y)
+	}
+	defer C.CFRelease(C.CFTypeRef(event))
+	C.CGEventPost(C.kCGHIDEventTap, event)
 	return nil
 }
 
@@ -163,8 +282,11 @@ func getMousePosition() C.CGPoint {
 	return C.CGEventGetLocation(event)
 }
 
-// ToggleMouse toggle mouse button event
-func (d *DCap) ToggleMouse(button MouseButton, down bool) error {
+// toggleMouse toggle mouse button event, d.inputMu must be held
+func (d *DCap) toggleMouse(button MouseButton, down bool) error {
+	if d.backend != nil {
+		return d.backend.toggleMouse(button, down)
+	}
 	var t C.CGEventType
 	var btn C.CGMouseButton
 	switch button {
@@ -196,8 +318,15 @@ func (d *DCap) ToggleMouse(button MouseButton, down bool) error {
 	return nil
 }
 
-// ToggleKey toggle keyboard event
-func (d *DCap) ToggleKey(key string, down bool) error {
+// toggleKey toggle keyboard event, d.inputMu must be held
+func (d *DCap) toggleKey(key string, down bool) error {
+	if d.backend != nil {
+		return d.backend.toggleKey(key, down)
+	}
+	// 0 is the code of "a", unknown keys are missing from the table
+	if _, ok := keycode.Maps[key]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
 	code := checkKeycodes(key)
 	event := C.CGEventCreateKeyboardEvent(C.CGEventSourceRef(0), C.CGKeyCode(code), true)
 	if event == 0 {
@@ -247,7 +376,24 @@ func (d *DCap) ToggleKey(key string, down bool) error {
 
 // Scroll mouse scroll
 func (d *DCap) Scroll(x, y int) {
+	_ = d.scrollContext(context.Background(), x, y)
+}
+
+// scrollContext Scroll once inputMu is taken, unless ctx is done first
+func (d *DCap) scrollContext(ctx context.Context, x, y int) error {
+	if d.isClosed() {
+		return nil
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.inputMu.Unlock()
+	if d.backend != nil {
+		d.backend.scroll(x, y)
+		return nil
+	}
 	event := C.createWheelEvent(C.int(x), C.int(y))
 	defer C.CFRelease(C.CFTypeRef(event))
 	C.CGEventPost(C.kCGHIDEventTap, event)
+	return nil
 }
@@ -1,163 +1,365 @@
 package dcap
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"image"
-	"image/color"
 	"math"
+	"sync"
+	"time"
 
-	"github.com/gen2brain/shm"
+	"github.com/diiyw/dcap/internal/clipboard"
+	"github.com/diiyw/dcap/internal/xconn"
 	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/damage"
+	"github.com/jezek/xgb/randr"
 	mshm "github.com/jezek/xgb/shm"
+	"github.com/jezek/xgb/xfixes"
 	"github.com/jezek/xgb/xinerama"
 	"github.com/jezek/xgb/xproto"
 	"github.com/jezek/xgb/xtest"
 )
 
-type DCap struct {
-	im                *image.RGBA
-	Displays          []image.Rectangle
-	xgbConn           *xgb.Conn
-	useShm            bool
-	defaultScreen     *xproto.ScreenInfo
-	wholeScreenBounds image.Rectangle
+// nativeBackends backends implemented by DCap itself, by default MIT-SHM
+// is used when available and GetImage otherwise
+var nativeBackends = []string{BackendX11Shm, BackendX11GetImage}
+
+// errNoInput input injection needs the XTest extension
+var errNoInput = fmt.Errorf("%w: input needs the XTest extension", ErrUnsupported)
+
+// state of DCap over X11
+type state struct {
+	common
+
+	xgbConn       *xgb.Conn
+	useShm        bool
+	defaultScreen *xproto.ScreenInfo
+	// screenNum number of defaultScreen, the primary screen
+	screenNum int
+	// screens every X screen, primary first
+	screens []xscreen
+	// origin position of the primary display in the space of all screens
+	origin image.Point
+	randr  bool
+	// monitors RandR 1.5 monitors are available, e.g. set by xrandr
+	// --setmonitor
+	monitors bool
+	xinerama bool
+	caps     Capabilities
+	// dial open another connection to the display
+	dial func() (*xgb.Conn, error)
+	// opts options of the connection, kept to reconnect
+	opts options
+
+	// grabber capture over xgbConn, workers over their own connections
+	grabber   *grabber
+	workersMu sync.Mutex
+	workers   []*grabber
 }
 
-func NewDCap() (*DCap, error) {
-	c, err := xgb.NewConn()
-	if err != nil {
+// reconnectDelay first wait before reconnecting
+const reconnectDelay = 100 * time.Millisecond
+
+// newNativeDCap create new dcap over the X server of o.display, $DISPLAY
+// by default
+func newNativeDCap(o *options) (*DCap, error) {
+	var d = &DCap{state: &state{
+		common: common{
+			events: make(chan Event, eventBuffer),
+			board:  clipboard.Board{Display: o.display, Xauthority: o.xauthority},
+		},
+		opts: *o,
+		dial: func() (*xgb.Conn, error) {
+			c, _, err := xconn.Dial(o.display, o.xauthority)
+			return c, err
+		},
+	}}
+	if err := d.connect(); err != nil {
 		return nil, err
 	}
-	if err = xinerama.Init(c); err != nil {
-		return nil, err
+	return d, nil
+}
+
+// connect open the connection to the X server and initialise the
+// extensions, the displays and the grabber, the previous connection is
+// replaced when reconnecting
+func (d *state) connect() error {
+	o := &d.opts
+	c, screen, err := xconn.Dial(o.display, o.xauthority)
+	if err != nil {
+		return xError("connect", err)
 	}
-	if err = xtest.Init(c); err != nil {
-		return nil, err
+	if o.screen != nil {
+		screen = *o.screen
 	}
-	reply, err := xinerama.QueryScreens(c).Reply()
-	if err != nil {
-		return nil, err
+	roots := xproto.Setup(c).Roots
+	if screen < 0 || len(roots) <= screen {
+		c.Close()
+		return fmt.Errorf("%w: screen %d", ErrDisplayNotFound, screen)
 	}
-	var d = &DCap{
-		xgbConn:  c,
-		Displays: make([]image.Rectangle, len(reply.ScreenInfo)),
+	useShm := o.backend != BackendX11GetImage && mshm.Init(c) == nil
+	if o.backend == BackendX11Shm && !useShm {
+		c.Close()
+		return fmt.Errorf("%w: MIT-SHM extension missing", ErrUnsupported)
 	}
 
-	primary := reply.ScreenInfo[0]
-	x0 := int(primary.XOrg)
-	y0 := int(primary.YOrg)
-	for i, screenInfo := range reply.ScreenInfo {
-		x := int(screenInfo.XOrg) - x0
-		y := int(screenInfo.YOrg) - y0
-		w := int(screenInfo.Width)
-		h := int(screenInfo.Height)
-		d.Displays[i] = image.Rect(x, y, x+w, y+h)
+	// capture and input wait until the new connection is set up
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
+	d.inputMu.Lock()
+	defer d.inputMu.Unlock()
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		c.Close()
+		return fmt.Errorf("%w: closed", ErrConnectionLost)
+	}
+	d.xgbConn = c
+	d.defaultScreen = &roots[screen]
+	d.screenNum = screen
+	// every extension is optional, displays fall back to the root window
+	// and input is unavailable without XTest
+	d.xinerama = xinerama.Init(c) == nil
+	d.initRandR()
+	d.caps = Capabilities{
+		Capture: true,
+		Shm:     useShm,
+		Input:   xtest.Init(c) == nil,
+		Cursor:  xfixes.Init(c) == nil,
+		Damage:  damage.Init(c) == nil,
+	}
+	d.mu.Unlock()
+	if err = d.refreshDisplays(); err != nil {
+		c.Close()
+		return err
 	}
 
-	d.useShm = true
-	err = mshm.Init(d.xgbConn)
-	if err != nil {
-		d.useShm = false
+	// segments and workers of the lost connection are released
+	d.closeGrabbers()
+	d.workersMu.Lock()
+	d.useShm = useShm
+	d.grabber = newGrabber(c, useShm)
+	d.workersMu.Unlock()
+	go d.eventLoop(c)
+	return nil
+}
+
+// eventLoop refresh displays on RandR notifications until c is closed, and
+// report the loss of the connection
+func (d *state) eventLoop(c *xgb.Conn) {
+	for {
+		ev, err := c.WaitForEvent()
+		if ev == nil && err == nil {
+			break
+		}
+		switch ev.(type) {
+		case randr.ScreenChangeNotifyEvent, randr.NotifyEvent:
+			_ = d.refreshDisplays()
+		}
+	}
+	d.mu.RLock()
+	closed := d.closed
+	d.mu.RUnlock()
+	if closed {
+		return
+	}
+	// xgb closes the connection on read and write errors
+	d.emit(Event{Type: ConnectionLost, Err: &Error{Op: "connection", Err: ErrConnectionLost}})
+	if d.opts.reconnect > 0 {
+		d.reconnect()
+	}
+}
+
+// reconnect dial the X server until it answers or DCap is closed, waiting
+// twice longer after each failure up to opts.reconnect
+func (d *state) reconnect() {
+	delay := reconnectDelay
+	for {
+		time.Sleep(delay)
+		d.mu.RLock()
+		closed := d.closed
+		d.mu.RUnlock()
+		if closed {
+			return
+		}
+		if err := d.connect(); err == nil {
+			d.emit(Event{Type: Reconnected})
+			return
+		}
+		delay = min(delay*2, d.opts.reconnect)
 	}
-	d.defaultScreen = xproto.Setup(c).DefaultScreen(c)
-	d.wholeScreenBounds = image.Rect(0, 0, int(d.defaultScreen.WidthInPixels), int(d.defaultScreen.HeightInPixels))
-	return d, nil
 }
 
-// Close close connection
-func (d *DCap) Close() {
-	d.xgbConn.Close()
+// emit send event without blocking
+func (d *state) emit(ev Event) {
+	select {
+	case d.events <- ev:
+	default:
+	}
 }
 
-func (d *DCap) Capture(x, y, width, height int) error {
-	d.NewImage(x, y, width, height)
-	reply, err := xinerama.QueryScreens(d.xgbConn).Reply()
+// refreshDisplays query the displays and report their changes
+func (d *state) refreshDisplays() error {
+	displays, screens, err := d.queryScreens()
 	if err != nil {
 		return err
 	}
 
-	primary := reply.ScreenInfo[0]
-	x0 := int(primary.XOrg)
-	y0 := int(primary.YOrg)
-
-	targetBounds := image.Rect(x+x0, y+y0, x+x0+width, y+y0+height)
-	intersect := d.wholeScreenBounds.Intersect(targetBounds)
-
-	if !intersect.Empty() {
-		var data []byte
-
-		if d.useShm {
-			shmSize := intersect.Dx() * intersect.Dy() * 4
-			shmId, err := shm.Get(shm.IPC_PRIVATE, shmSize, shm.IPC_CREAT|0777)
-			if err != nil {
-				return err
-			}
-
-			seg, err := mshm.NewSegId(d.xgbConn)
-			if err != nil {
-				return err
-			}
-
-			data, err = shm.At(shmId, 0, 0)
-			if err != nil {
-				return err
-			}
-
-			mshm.Attach(d.xgbConn, seg, uint32(shmId), false)
-
-			defer mshm.Detach(d.xgbConn, seg)
-			defer func() {
-				_ = shm.Rm(shmId)
-			}()
-			defer func() {
-				_ = shm.Dt(data)
-			}()
-
-			_, err = mshm.GetImage(d.xgbConn, xproto.Drawable(d.defaultScreen.Root),
-				int16(intersect.Min.X), int16(intersect.Min.Y),
-				uint16(intersect.Dx()), uint16(intersect.Dy()), 0xffffffff,
-				byte(xproto.ImageFormatZPixmap), seg, 0).Reply()
-			if err != nil {
-				return err
-			}
-		} else {
-			xImg, err := xproto.GetImage(d.xgbConn, xproto.ImageFormatZPixmap, xproto.Drawable(d.defaultScreen.Root),
-				int16(intersect.Min.X), int16(intersect.Min.Y),
-				uint16(intersect.Dx()), uint16(intersect.Dy()), 0xffffffff).Reply()
-			if err != nil {
-				return err
-			}
-
-			data = xImg.Data
+	// displays are relative to the primary display
+	origin := displays[0].Bounds.Min
+	bounds := make([]image.Rectangle, len(displays))
+	for i := range displays {
+		displays[i].Bounds = displays[i].Bounds.Sub(origin)
+		bounds[i] = displays[i].Bounds
+	}
+
+	d.mu.Lock()
+	old := d.Displays
+	d.Displays = bounds
+	d.displays = displays
+	d.origin = origin
+	d.screens = screens
+	d.mu.Unlock()
+	if old != nil {
+		for _, ev := range diffDisplays(old, bounds) {
+			d.emit(ev)
 		}
+	}
+	return nil
+}
+
+// Capabilities report the features supported by the X server, none after
+// Close
+func (d *DCap) Capabilities() Capabilities {
+	if d.isClosed() {
+		return Capabilities{}
+	}
+	if d.backend != nil {
+		return d.backend.capabilities()
+	}
+	d.mu.RLock()
+	caps := d.caps
+	d.mu.RUnlock()
+	caps.Clipboard = d.board.Available()
+	return caps
+}
+
+// Close release the keys and buttons held down, the selections, the shared
+// memory segments and the connection, later calls do nothing
+func (d *DCap) Close() error {
+	ok, err := d.shutdown()
+	if !ok {
+		return nil
+	}
+	return errors.Join(err, d.release())
+}
+
+// release close the connections and free the shared memory segments of d
+// marked closed, without waiting on the server
+func (d *DCap) release() error {
+	if d.backend != nil {
+		return d.backend.close()
+	}
+	// a call hung on the server holds its lock, closing the socket first
+	// makes it fail with io.EOF
+	d.mu.RLock()
+	c := d.xgbConn
+	d.mu.RUnlock()
+	xconn.Close(c)
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
+	d.inputMu.Lock()
+	defer d.inputMu.Unlock()
+	d.closeGrabbers()
+	return nil
+}
+
+// capture capture rect into im, d.captureMu must be held
+func (d *DCap) capture(rect image.Rectangle) error {
+	d.newImage(rect.Dx(), rect.Dy())
+	return d.captureInto(d.im, rect)
+}
 
-		// BitBlt by hand
-		offset := 0
-		for iy := intersect.Min.Y; iy < intersect.Max.Y; iy++ {
-			for ix := intersect.Min.X; ix < intersect.Max.X; ix++ {
-				r := data[offset+2]
-				g := data[offset+1]
-				b := data[offset]
-				d.im.SetRGBA(ix-(x+x0), iy-(y+y0), color.RGBA{r, g, b, 255})
-				offset += 4
-			}
+// captureRaw read rect of the virtual desktop and pass the pixels to fn
+// with their offset from rect.Min, pixels outside of the screen are skipped
+func (d *DCap) captureRaw(rect image.Rectangle, fn func(off image.Point, src pixels)) error {
+	if err := d.checkOpen("capture"); err != nil {
+		return err
+	}
+	if d.backend != nil {
+		return d.backend.captureRaw(rect, fn)
+	}
+	d.mu.RLock()
+	rect = rect.Add(d.origin)
+	screens := d.screens
+	d.mu.RUnlock()
+	for _, s := range screens {
+		if !rect.Overlaps(s.bounds) {
+			continue
+		}
+		// read the part of rect on s in its root window coordinates
+		offset := s.bounds.Min
+		if _, err := d.grabber.capture(context.Background(), s.root, rect.Sub(offset), s.bounds.Sub(offset), fn); err != nil {
+			return xError("GetImage", err)
 		}
 	}
 	return nil
 }
 
-// MouseMove move mouse to x,y
+// screenAt return the screen showing p of the space of all screens, the
+// primary screen if none does
+func (d *DCap) screenAt(p image.Point) xscreen {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, s := range d.screens {
+		if p.In(s.bounds) {
+			return s
+		}
+	}
+	return d.screens[0]
+}
+
+// MouseMove move mouse to x,y of the virtual desktop
 func (d *DCap) MouseMove(x, y int) error {
-	cookie := xproto.WarpPointerChecked(d.xgbConn, xproto.WindowNone, d.defaultScreen.Root, 0, 0, 0, 0, int16(x), int16(y))
-	if err := cookie.Check(); err != nil {
+	return d.mouseMoveContext(context.Background(), x, y)
+}
+
+// mouseMoveContext MouseMove once inputMu is taken, unless ctx is done first
+func (d *DCap) mouseMoveContext(ctx context.Context, x, y int) error {
+	if err := d.checkOpen("move mouse"); err != nil {
+		return err
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
 		return err
 	}
+	defer d.inputMu.Unlock()
+	if d.backend != nil {
+		return d.backend.mouseMove(x, y)
+	}
+	d.mu.RLock()
+	p := image.Pt(x, y).Add(d.origin)
+	d.mu.RUnlock()
+	// the pointer moves to another screen when warped to its root window
+	s := d.screenAt(p)
+	p = p.Sub(s.bounds.Min)
+	cookie := xproto.WarpPointerChecked(d.xgbConn, xproto.WindowNone, s.root, 0, 0, 0, 0, int16(p.X), int16(p.Y))
+	if err := cookie.Check(); err != nil {
+		return xError("WarpPointer", err)
+	}
 	d.xgbConn.Sync()
 	return nil
 }
 
-// ToggleMouse toggle mouse button event, https://www.x.org/releases/X11R7.7/doc/xextproto/xtest.html
-func (d *DCap) ToggleMouse(button MouseButton, down bool) error {
+// toggleMouse toggle mouse button event, d.inputMu must be held,
+// https://www.x.org/releases/X11R7.7/doc/xextproto/xtest.html
+func (d *DCap) toggleMouse(button MouseButton, down bool) error {
+	if d.backend != nil {
+		return d.backend.toggleMouse(button, down)
+	}
+	if !d.caps.Input {
+		return errNoInput
+	}
 	var typ byte = xproto.ButtonPress
 	if !down {
 		typ = xproto.ButtonRelease
@@ -165,17 +367,23 @@ func (d *DCap) ToggleMouse(button MouseButton, down bool) error {
 	// Simulate a left mouse button press event
 	cookie := xtest.FakeInputChecked(d.xgbConn, typ, byte(button)+1, 0, d.defaultScreen.Root, 0, 0, 0)
 	if err := cookie.Check(); err != nil {
-		return err
+		return xError("FakeInput", err)
 	}
 	d.xgbConn.Sync()
 	return nil
 }
 
-// ToggleKey toggle keyboard event
-func (d *DCap) ToggleKey(key string, down bool) error {
+// toggleKey toggle keyboard event, d.inputMu must be held
+func (d *DCap) toggleKey(key string, down bool) error {
+	if d.backend != nil {
+		return d.backend.toggleKey(key, down)
+	}
+	if !d.caps.Input {
+		return errNoInput
+	}
 	var code byte = byte(checkKeycodes(key))
 	if code == 0 {
-		return fmt.Errorf("key not found: %s", key)
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
 	}
 	var eventType byte = xproto.KeyPress // key down
 	if !down {
@@ -184,11 +392,30 @@ func (d *DCap) ToggleKey(key string, down bool) error {
 
 	cookie := xtest.FakeInputChecked(d.xgbConn, eventType, code, 0, d.defaultScreen.Root, 0, 0, 0)
 	if err := cookie.Check(); err != nil {
-		return err
+		return xError("FakeInput", err)
 	}
 	return nil
 }
 func (d *DCap) Scroll(x, y int) {
+	_ = d.scrollContext(context.Background(), x, y)
+}
+
+// scrollContext Scroll once inputMu is taken, unless ctx is done first
+func (d *DCap) scrollContext(ctx context.Context, x, y int) error {
+	if d.isClosed() {
+		return nil
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.inputMu.Unlock()
+	if d.backend != nil {
+		d.backend.scroll(x, y)
+		return nil
+	}
+	if !d.caps.Input {
+		return nil
+	}
 	var ydir byte = 4 /* Button 4 is up, 5 is down. */
 	var xdir byte = 6
 
@@ -208,4 +435,5 @@ func (d *DCap) Scroll(x, y int) {
 		xtest.FakeInput(d.xgbConn, ydir, 0, 0, d.defaultScreen.Root, int16(x), int16(y), 0)
 	}
 	d.xgbConn.Sync()
+	return nil
 }
@@ -2,10 +2,19 @@ package dcap
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"image"
+	"image/color"
+	"sync"
 	"testing"
+	"time"
 )
 
+// privateXvfb set when the tests run on an Xvfb of their own, its screen
+// does not change between captures
+var privateXvfb bool
+
 func TestDCap(t *testing.T) {
 	d, err := NewDCap()
 	if err != nil {
@@ -25,11 +34,175 @@ func TestDCap(t *testing.T) {
 	if im.Bounds().Dx() != im2.Bounds().Dx() || im.Bounds().Dy() != im2.Bounds().Dy() {
 		t.Fatal("image size not equal")
 	}
-	if bytes.Equal(im.Pix, im2.Pix) {
+	if !privateXvfb && bytes.Equal(im.Pix, im2.Pix) {
 		t.Fatal("image data equal")
 	}
 }
 
+func TestCaptureInto(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pool FramePool
+	buf := pool.Get(200, 100)
+	defer pool.Put(buf)
+	// right half of the buffer
+	dst := buf.SubImage(image.Rect(100, 0, 200, 100)).(*image.RGBA)
+	if err = d.CaptureInto(dst, image.Rect(0, 0, 100, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Pix[buf.PixOffset(199, 99)+3] != 255 {
+		t.Fatal("sub-image not captured")
+	}
+}
+
+func TestCaptureIntoFormats(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rect := image.Rect(0, 0, 64, 64)
+	for _, dst := range []image.Image{
+		image.NewGray(rect),
+		image.NewNRGBA(rect),
+		image.NewYCbCr(rect, image.YCbCrSubsampleRatio420),
+		NewBGRA(rect),
+	} {
+		if err = d.CaptureInto(dst, rect); err != nil {
+			t.Fatalf("%T: %v", dst, err)
+		}
+	}
+	if err = d.CaptureInto(image.NewAlpha(rect), rect); err == nil {
+		t.Fatal("expected error for *image.Alpha")
+	}
+}
+
+func TestCaptureScaled(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := d.Displays[0]
+	for _, filter := range []Filter{Nearest, Box, Bilinear} {
+		im, err := d.CaptureScaled(bounds, 160, 90, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if im.Bounds() != image.Rect(0, 0, 160, 90) {
+			t.Fatalf("thumbnail bounds %v", im.Bounds())
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	var wg sync.WaitGroup
+	errs := make(chan error, 60)
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				errs <- d.Capture(0, 0, 50+i, 50)
+				_ = d.Image()
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			dst := image.NewGray(image.Rect(0, 0, 32, 32))
+			for j := 0; j < 5; j++ {
+				errs <- d.CaptureInto(dst, dst.Rect)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				errs <- d.MouseMove(i*10, j*10)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCaptureContext(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = d.CaptureContext(ctx, 0, 0, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.MouseMoveContext(ctx, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCaptureAll(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetBackground(color.White)
+	im, regions, err := d.CaptureAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != len(d.Displays) {
+		t.Fatal("missing display regions")
+	}
+	for i, region := range regions {
+		if !region.In(im.Bounds()) || region.Size() != d.Displays[i].Size() {
+			t.Fatalf("display %d region %v", i, region)
+		}
+	}
+}
+
+func TestCaptureDisplays(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	frames, err := d.CaptureDisplays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != len(d.Displays) {
+		t.Fatal("missing frames")
+	}
+	for i, frame := range frames {
+		if frame.Index != i || frame.Image.Bounds().Size() != d.Displays[i].Size() || frame.Time.IsZero() {
+			t.Fatalf("frame %d: index %d size %v", i, frame.Index, frame.Image.Bounds().Size())
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := d.Capabilities()
+	fmt.Printf("Capabilities: %+v\n", caps)
+	if !caps.Capture {
+		t.Fatal("capture unsupported")
+	}
+}
+
 func TestClipboard(t *testing.T) {
 	d, err := NewDCap()
 	if err != nil {
@@ -45,6 +218,96 @@ func TestClipboard(t *testing.T) {
 	fmt.Println(text)
 }
 
+func TestWatchClipboard(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	events, err := d.WatchClipboard(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ClipboardSet("Hello Watch"); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := <-events
+	if !ok {
+		t.Fatal("no clipboard event")
+	}
+	text, err := ev.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Local || text != "Hello Watch" {
+		t.Fatalf("unexpected event %+v %q", ev, text)
+	}
+}
+
+func TestSelectionPrimary(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.SelectionSet(SelectionPrimary, "Hello Primary"); err != nil {
+		t.Fatal(err)
+	}
+	text, err := d.SelectionGet(SelectionPrimary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Hello Primary" {
+		t.Fatalf("primary selection %q", text)
+	}
+}
+
+func TestClipboardData(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := []byte("<b>Hello World</b>")
+	if err = d.ClipboardSetData(map[string][]byte{
+		"text/plain": []byte("Hello World"),
+		"text/html":  html,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	targets, err := d.ClipboardTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(targets)
+	data, err := d.ClipboardGetData("text/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, html) {
+		t.Fatal("clipboard data not equal")
+	}
+}
+
+func TestClipboardImage(t *testing.T) {
+	d, err := NewDCap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.CaptureDisplay(0); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ClipboardSetImage(d.Image()); err != nil {
+		t.Fatal(err)
+	}
+	im, err := d.ClipboardGetImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.Bounds().Dx() != d.Displays[0].Dx() || im.Bounds().Dy() != d.Displays[0].Dy() {
+		t.Fatal("image size not equal")
+	}
+}
+
 func TestMouseMove(t *testing.T) {
 	d, err := NewDCap()
 	if err != nil {
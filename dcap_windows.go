@@ -7,7 +7,9 @@ package dcap
 import "C"
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/diiyw/dcap/internal/windef"
 	"github.com/lxn/win"
 	"image"
@@ -15,20 +17,26 @@ import (
 	"unsafe"
 )
 
-type DCap struct {
-	im           *image.RGBA
-	Displays     []image.Rectangle
+// nativeBackends backends implemented by DCap itself
+var nativeBackends = []string{BackendGDI}
+
+// state of DCap over GDI
+type state struct {
+	common
+
 	hdc          win.HDC
 	memoryDevice win.HDC
 	bitmap       win.HBITMAP
+	bitmapSize   image.Point
 }
 
-func NewDCap() (*DCap, error) {
-	var d = &DCap{}
+// newNativeDCap create new dcap over GDI
+func newNativeDCap(o *options) (*DCap, error) {
+	var d = emptyDCap()
 	hWnd := windef.GetDesktopWindow()
 	d.hdc = win.GetDC(hWnd)
 	if d.hdc == 0 {
-		return nil, errors.New("GetDC failed")
+		return nil, &Error{Op: "GetDC"}
 	}
 	d.memoryDevice = win.CreateCompatibleDC(d.hdc)
 	var count = 0
@@ -37,22 +45,77 @@ func NewDCap() (*DCap, error) {
 	for i := 0; i < count; i++ {
 		d.Displays[i] = windef.GetDisplayBounds(i)
 	}
+	d.displays = displaysFromBounds(d.Displays)
 	return d, nil
 }
 
-func (d *DCap) Close() {
+// Capabilities report the features supported by the system, none after
+// Close
+func (d *DCap) Capabilities() Capabilities {
+	if d.isClosed() {
+		return Capabilities{}
+	}
+	if d.backend != nil {
+		return d.backend.capabilities()
+	}
+	return Capabilities{
+		Capture:   true,
+		Input:     true,
+		Cursor:    true,
+		Clipboard: true,
+	}
+}
+
+// Close release the keys and buttons held down and the GDI objects, later
+// calls do nothing
+func (d *DCap) Close() error {
+	ok, err := d.shutdown()
+	if !ok {
+		return nil
+	}
+	return errors.Join(err, d.release())
+}
+
+// release delete the GDI objects of d marked closed
+func (d *DCap) release() error {
+	if d.backend != nil {
+		return d.backend.close()
+	}
+	d.captureMu.Lock()
+	defer d.captureMu.Unlock()
 	win.ReleaseDC(win.HWND(0), d.hdc)
 	win.DeleteDC(d.memoryDevice)
-	win.DeleteObject(win.HGDIOBJ(d.bitmap))
+	if d.bitmap != 0 {
+		win.DeleteObject(win.HGDIOBJ(d.bitmap))
+	}
+	return nil
+}
+
+// capture capture rect into im, d.captureMu must be held
+func (d *DCap) capture(rect image.Rectangle) error {
+	d.newImage(rect.Dx(), rect.Dy())
+	return d.captureInto(d.im, rect)
 }
 
-func (d *DCap) Capture(x, y, width, height int) error {
-	d.NewImage(x, y, width, height)
-	if d.bitmap == 0 {
+// captureRaw read rect of the virtual desktop and pass the BGRA pixels of
+// the DIB to fn
+func (d *DCap) captureRaw(rect image.Rectangle, fn func(off image.Point, src pixels)) error {
+	if err := d.checkOpen("capture"); err != nil {
+		return err
+	}
+	if d.backend != nil {
+		return d.backend.captureRaw(rect, fn)
+	}
+	width, height := rect.Dx(), rect.Dy()
+	if d.bitmap == 0 || d.bitmapSize != rect.Size() {
+		if d.bitmap != 0 {
+			win.DeleteObject(win.HGDIOBJ(d.bitmap))
+		}
 		d.bitmap = win.CreateCompatibleBitmap(d.hdc, int32(width), int32(height))
 		if d.bitmap == 0 {
-			return errors.New("CreateCompatibleBitmap failed")
+			return &Error{Op: "CreateCompatibleBitmap"}
 		}
+		d.bitmapSize = rect.Size()
 	}
 
 	var header win.BITMAPINFOHEADER
@@ -75,44 +138,59 @@ func (d *DCap) Capture(x, y, width, height int) error {
 
 	old := win.SelectObject(d.memoryDevice, win.HGDIOBJ(d.bitmap))
 	if old == 0 {
-		return errors.New("SelectObject failed")
+		return &Error{Op: "SelectObject"}
 	}
 	defer win.SelectObject(d.memoryDevice, old)
 
-	if !win.BitBlt(d.memoryDevice, 0, 0, int32(width), int32(height), d.hdc, int32(x), int32(y), win.SRCCOPY) {
-		return errors.New("BitBlt failed")
+	if !win.BitBlt(d.memoryDevice, 0, 0, int32(width), int32(height), d.hdc, int32(rect.Min.X), int32(rect.Min.Y), win.SRCCOPY) {
+		return &Error{Op: "BitBlt"}
 	}
 
 	if win.GetDIBits(d.hdc, d.bitmap, 0, uint32(height), (*uint8)(memPtr), (*win.BITMAPINFO)(unsafe.Pointer(&header)), win.DIB_RGB_COLORS) == 0 {
-		return errors.New("GetDIBits failed")
+		return &Error{Op: "GetDIBits"}
 	}
 
-	i := 0
-	src := uintptr(memPtr)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			v0 := *(*uint8)(unsafe.Pointer(src))
-			v1 := *(*uint8)(unsafe.Pointer(src + 1))
-			v2 := *(*uint8)(unsafe.Pointer(src + 2))
+	fn(image.Point{}, pixels{pix: unsafe.Slice((*byte)(memPtr), bitmapDataSize), stride: width * 4, size: rect.Size()})
+	return nil
+}
 
-			// BGRA => RGBA, and set A to 255
-			d.im.Pix[i], d.im.Pix[i+1], d.im.Pix[i+2], d.im.Pix[i+3] = v2, v1, v0, 255
+// CaptureDisplays capture displays one after another, every display when
+// no index is given
+func (d *DCap) CaptureDisplays(indices ...int) ([]Frame, error) {
+	return d.captureDisplaysSerial(context.Background(), indices)
+}
 
-			i += 4
-			src += 4
-		}
-	}
-	return nil
+// captureDisplaysContext CaptureDisplays unless ctx is done first
+func (d *DCap) captureDisplaysContext(ctx context.Context, indices []int) ([]Frame, error) {
+	return d.captureDisplaysSerial(ctx, indices)
 }
 
-// MouseMove move mouse to x,y
+// MouseMove move mouse to x,y of the virtual desktop
 func (d *DCap) MouseMove(x, y int) error {
-	C.mouse_move(C.uint(x), C.uint(y))
+	return d.mouseMoveContext(context.Background(), x, y)
+}
+
+// mouseMoveContext MouseMove once inputMu is taken, unless ctx is done first
+func (d *DCap) mouseMoveContext(ctx context.Context, x, y int) error {
+	if err := d.checkOpen("move mouse"); err != nil {
+		return err
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.inputMu.Unlock()
+	if d.backend != nil {
+		return d.backend.mouseMove(x, y)
+	}
+	C.mouse_move(C.int32_t(x), C.int32_t(y))
 	return nil
 }
 
-// ToggleMouse toggle mouse button event
-func (d *DCap) ToggleMouse(button MouseButton, down bool) error {
+// toggleMouse toggle mouse button event, d.inputMu must be held
+func (d *DCap) toggleMouse(button MouseButton, down bool) error {
+	if d.backend != nil {
+		return d.backend.toggleMouse(button, down)
+	}
 	switch button {
 	case MouseLeft:
 		C.mouse_toggle(0, C.bool(down))
@@ -124,14 +202,38 @@ func (d *DCap) ToggleMouse(button MouseButton, down bool) error {
 	return nil
 }
 
-// ToggleKey toggle keyboard event
-func (d *DCap) ToggleKey(key string, down bool) error {
+// toggleKey toggle keyboard event, d.inputMu must be held
+func (d *DCap) toggleKey(key string, down bool) error {
+	if d.backend != nil {
+		return d.backend.toggleKey(key, down)
+	}
 	code := checkKeycodes(key)
+	// VkKeyScan answers -1 for characters without a key
+	if code == 0 || code&0xff == 0xff {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
 	C.keyboard_toggle(C.uint(code), C.bool(down))
 	return nil
 }
 
 // Scroll mouse scroll
 func (d *DCap) Scroll(x, y int) {
+	_ = d.scrollContext(context.Background(), x, y)
+}
+
+// scrollContext Scroll once inputMu is taken, unless ctx is done first
+func (d *DCap) scrollContext(ctx context.Context, x, y int) error {
+	if d.isClosed() {
+		return nil
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.inputMu.Unlock()
+	if d.backend != nil {
+		d.backend.scroll(x, y)
+		return nil
+	}
 	C.scroll(C.uint(x), C.uint(y))
+	return nil
 }
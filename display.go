@@ -0,0 +1,102 @@
+package dcap
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Display description of a display
+type Display struct {
+	// Name name of the output such as HDMI-1, empty if unknown
+	Name string
+	// Make manufacturer id and Model monitor name, read from EDID
+	Make  string
+	Model string
+	// Bounds same bounds as in Displays
+	Bounds image.Rectangle
+	// WidthMM and HeightMM physical size in millimeters, 0 if unknown
+	WidthMM  int
+	HeightMM int
+	// RefreshRate refresh rate in Hz, 0 if unknown
+	RefreshRate float64
+	// Rotation counterclockwise rotation in degrees
+	Rotation int
+	Primary  bool
+	// Screen X screen showing the display, 0 elsewhere
+	Screen int
+}
+
+// DPI return dots per inch of display, 0 if the physical size is unknown
+func (d Display) DPI() (x, y float64) {
+	if d.WidthMM > 0 {
+		x = float64(d.Bounds.Dx()) * 25.4 / float64(d.WidthMM)
+	}
+	if d.HeightMM > 0 {
+		y = float64(d.Bounds.Dy()) * 25.4 / float64(d.HeightMM)
+	}
+	return x, y
+}
+
+// DisplayInfo return description of the displays, in the order of Displays
+func (d *DCap) DisplayInfo() []Display {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	displays := make([]Display, len(d.displays))
+	copy(displays, d.displays)
+	return displays
+}
+
+// CaptureDisplayByName capture display by output name such as HDMI-1
+func (d *DCap) CaptureDisplayByName(name string) error {
+	d.mu.RLock()
+	var rect image.Rectangle
+	found := false
+	for _, display := range d.displays {
+		if display.Name == name {
+			rect, found = display.Bounds, true
+			break
+		}
+	}
+	d.mu.RUnlock()
+	if !found {
+		return fmt.Errorf("%w: %s", ErrDisplayNotFound, name)
+	}
+	return d.Capture(rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy())
+}
+
+// displaysFromBounds describe displays known only by their bounds, the
+// primary display is at the origin
+func displaysFromBounds(bounds []image.Rectangle) []Display {
+	displays := make([]Display, len(bounds))
+	for i, b := range bounds {
+		displays[i] = Display{Bounds: b, Primary: b.Min == image.Point{}}
+	}
+	return displays
+}
+
+var edidHeader = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// parseEDID read manufacturer id and monitor name from EDID, the product
+// code is used when the monitor has no name
+func parseEDID(edid []byte) (manufacturer, model string) {
+	if len(edid) < 128 || !bytes.Equal(edid[:8], edidHeader) {
+		return "", ""
+	}
+	id := uint16(edid[8])<<8 | uint16(edid[9])
+	manufacturer = string([]byte{
+		byte(id>>10&0x1f) + 'A' - 1,
+		byte(id>>5&0x1f) + 'A' - 1,
+		byte(id&0x1f) + 'A' - 1,
+	})
+	// display descriptors, 0xfc is the monitor name
+	for i := 54; i+18 <= 126; i += 18 {
+		desc := edid[i : i+18]
+		if desc[0] == 0 && desc[1] == 0 && desc[3] == 0xfc {
+			name, _, _ := bytes.Cut(desc[5:], []byte{'\n'})
+			return manufacturer, strings.TrimSpace(string(name))
+		}
+	}
+	return manufacturer, fmt.Sprintf("0x%04X", uint16(edid[10])|uint16(edid[11])<<8)
+}
@@ -0,0 +1,272 @@
+package dcap
+
+import (
+	"errors"
+	"image"
+	"sort"
+
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xinerama"
+	"github.com/jezek/xgb/xproto"
+)
+
+// initRandR select RandR notifications, displays are then read from RandR
+// monitors or outputs
+func (d *state) initRandR() {
+	c := d.xgbConn
+	d.randr, d.monitors = false, false
+	if err := randr.Init(c); err != nil {
+		return
+	}
+	version, err := randr.QueryVersion(c, 1, 5).Reply()
+	if err != nil || version.MajorVersion < 1 || version.MajorVersion == 1 && version.MinorVersion < 2 {
+		return
+	}
+	d.randr = true
+	d.monitors = version.MajorVersion > 1 || version.MinorVersion >= 5
+	for _, screen := range xproto.Setup(c).Roots {
+		randr.SelectInput(c, screen.Root, randr.NotifyMaskScreenChange|
+			randr.NotifyMaskCrtcChange|randr.NotifyMaskOutputChange)
+	}
+}
+
+// xscreen X screen, bounds is its root window placed in the space of all
+// screens, the primary screen first and the others on its right
+type xscreen struct {
+	num    int
+	root   xproto.Window
+	bounds image.Rectangle
+}
+
+// queryScreens query the displays of every X screen, those of the primary
+// screen first, in the space of all screens
+func (d *state) queryScreens() ([]Display, []xscreen, error) {
+	roots := xproto.Setup(d.xgbConn).Roots
+	order := []int{d.screenNum}
+	for i := range roots {
+		if i != d.screenNum {
+			order = append(order, i)
+		}
+	}
+	var displays []Display
+	var screens []xscreen
+	x := 0
+	for _, num := range order {
+		screen := &roots[num]
+		geometry, err := xproto.GetGeometry(d.xgbConn, xproto.Drawable(screen.Root)).Reply()
+		if err != nil {
+			return nil, nil, xError("GetGeometry", err)
+		}
+		list, err := d.queryDisplays(screen, num == d.screenNum)
+		if err != nil {
+			return nil, nil, err
+		}
+		offset := image.Pt(x, 0)
+		for _, display := range list {
+			display.Bounds = display.Bounds.Add(offset)
+			display.Screen = num
+			display.Primary = display.Primary && num == d.screenNum
+			displays = append(displays, display)
+		}
+		screens = append(screens, xscreen{
+			num:    num,
+			root:   screen.Root,
+			bounds: image.Rect(0, 0, int(geometry.Width), int(geometry.Height)).Add(offset),
+		})
+		x += int(geometry.Width)
+	}
+	return displays, screens, nil
+}
+
+// queryDisplays query displays of screen in root window coordinates,
+// primary first, from RandR, Xinerama or the root window. Xinerama only
+// describes the default screen
+func (d *state) queryDisplays(screen *xproto.ScreenInfo, xinerama bool) ([]Display, error) {
+	if d.randr {
+		displays, err := d.queryRandR(screen.Root)
+		if err == nil && len(displays) > 0 {
+			return displays, nil
+		}
+	}
+	if d.xinerama && xinerama {
+		displays, err := d.queryXinerama()
+		if err == nil {
+			return displays, nil
+		}
+	}
+	return d.queryRoot(screen)
+}
+
+// queryRoot describe the root window of screen as single display
+func (d *state) queryRoot(screen *xproto.ScreenInfo) ([]Display, error) {
+	geometry, err := xproto.GetGeometry(d.xgbConn, xproto.Drawable(screen.Root)).Reply()
+	if err != nil {
+		return nil, err
+	}
+	return []Display{{
+		Bounds:   image.Rect(0, 0, int(geometry.Width), int(geometry.Height)),
+		WidthMM:  int(screen.WidthInMillimeters),
+		HeightMM: int(screen.HeightInMillimeters),
+		Primary:  true,
+	}}, nil
+}
+
+// queryRandR query the monitors of root, or its outputs driven by a CRTC
+// before RandR 1.5
+func (d *state) queryRandR(root xproto.Window) ([]Display, error) {
+	c := d.xgbConn
+	resources, err := randr.GetScreenResourcesCurrent(c, root).Reply()
+	if err != nil {
+		return nil, err
+	}
+	var primary randr.Output
+	if reply, err := randr.GetOutputPrimary(c, root).Reply(); err == nil {
+		primary = reply.Output
+	}
+	edid, err := xproto.InternAtom(c, false, 4, "EDID").Reply()
+	if err != nil {
+		return nil, err
+	}
+	modes := make(map[randr.Mode]randr.ModeInfo, len(resources.Modes))
+	for _, mode := range resources.Modes {
+		modes[randr.Mode(mode.Id)] = mode
+	}
+
+	var displays []Display
+	outputs := make(map[randr.Output]Display)
+	crtcs := make(map[randr.Crtc]bool)
+	for _, output := range resources.Outputs {
+		info, err := randr.GetOutputInfo(c, output, resources.ConfigTimestamp).Reply()
+		if err != nil {
+			return nil, err
+		}
+		// mirrored outputs share their CRTC
+		if info.Connection != randr.ConnectionConnected || info.Crtc == 0 || crtcs[info.Crtc] {
+			continue
+		}
+		crtc, err := randr.GetCrtcInfo(c, info.Crtc, resources.ConfigTimestamp).Reply()
+		if err != nil {
+			return nil, err
+		}
+		if crtc.Width == 0 || crtc.Height == 0 {
+			continue
+		}
+		crtcs[info.Crtc] = true
+		display := Display{
+			Name:     string(info.Name),
+			Bounds:   image.Rect(int(crtc.X), int(crtc.Y), int(crtc.X)+int(crtc.Width), int(crtc.Y)+int(crtc.Height)),
+			WidthMM:  int(info.MmWidth),
+			HeightMM: int(info.MmHeight),
+			Rotation: rotation(crtc.Rotation),
+			Primary:  output == primary,
+		}
+		if mode, ok := modes[crtc.Mode]; ok {
+			display.RefreshRate = refreshRate(mode)
+		}
+		property, err := randr.GetOutputProperty(c, output, edid.Atom, xproto.GetPropertyTypeAny,
+			0, 128, false, false).Reply()
+		if err == nil {
+			display.Make, display.Model = parseEDID(property.Data)
+		}
+		displays = append(displays, display)
+		outputs[output] = display
+	}
+	if d.monitors {
+		monitors, err := d.queryMonitors(root, outputs)
+		if err == nil && len(monitors) > 0 {
+			return monitors, nil
+		}
+	}
+	sort.SliceStable(displays, func(i, j int) bool {
+		return displays[i].Primary && !displays[j].Primary
+	})
+	if len(displays) > 0 && primary == 0 {
+		displays[0].Primary = true
+	}
+	return displays, nil
+}
+
+// queryMonitors query the active monitors of root, primary first, they
+// describe the outputs or areas set by the user. A monitor is described
+// by the output it shows when it has one
+func (d *state) queryMonitors(root xproto.Window, outputs map[randr.Output]Display) ([]Display, error) {
+	c := d.xgbConn
+	reply, err := randr.GetMonitors(c, root, true).Reply()
+	if err != nil {
+		return nil, err
+	}
+	displays := make([]Display, 0, len(reply.Monitors))
+	primary := false
+	for _, monitor := range reply.Monitors {
+		var display Display
+		if len(monitor.Outputs) > 0 {
+			display = outputs[monitor.Outputs[0]]
+		}
+		if name, err := xproto.GetAtomName(c, monitor.Name).Reply(); err == nil {
+			display.Name = name.Name
+		}
+		x, y := int(monitor.X), int(monitor.Y)
+		display.Bounds = image.Rect(x, y, x+int(monitor.Width), y+int(monitor.Height))
+		display.WidthMM = int(monitor.WidthInMillimeters)
+		display.HeightMM = int(monitor.HeightInMillimeters)
+		display.Primary = monitor.Primary
+		primary = primary || monitor.Primary
+		displays = append(displays, display)
+	}
+	sort.SliceStable(displays, func(i, j int) bool {
+		return displays[i].Primary && !displays[j].Primary
+	})
+	if len(displays) > 0 && !primary {
+		displays[0].Primary = true
+	}
+	return displays, nil
+}
+
+// queryXinerama query the Xinerama screens, the first one is the primary
+func (d *state) queryXinerama() ([]Display, error) {
+	reply, err := xinerama.QueryScreens(d.xgbConn).Reply()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply.ScreenInfo) == 0 {
+		return nil, errors.New("no screen found")
+	}
+	displays := make([]Display, len(reply.ScreenInfo))
+	for i, screenInfo := range reply.ScreenInfo {
+		x := int(screenInfo.XOrg)
+		y := int(screenInfo.YOrg)
+		displays[i] = Display{
+			Bounds:  image.Rect(x, y, x+int(screenInfo.Width), y+int(screenInfo.Height)),
+			Primary: i == 0,
+		}
+	}
+	return displays, nil
+}
+
+// rotation convert RandR rotation to degrees
+func rotation(r uint16) int {
+	switch {
+	case r&randr.RotationRotate90 != 0:
+		return 90
+	case r&randr.RotationRotate180 != 0:
+		return 180
+	case r&randr.RotationRotate270 != 0:
+		return 270
+	}
+	return 0
+}
+
+// refreshRate compute refresh rate of mode in Hz
+func refreshRate(mode randr.ModeInfo) float64 {
+	vtotal := float64(mode.Vtotal)
+	if mode.ModeFlags&randr.ModeFlagDoubleScan != 0 {
+		vtotal *= 2
+	}
+	if mode.ModeFlags&randr.ModeFlagInterlace != 0 {
+		vtotal /= 2
+	}
+	if mode.Htotal == 0 || vtotal == 0 {
+		return 0
+	}
+	return float64(mode.DotClock) / (float64(mode.Htotal) * vtotal)
+}
@@ -0,0 +1,38 @@
+package dcap
+
+import (
+	"image"
+	"testing"
+)
+
+func TestParseEDID(t *testing.T) {
+	edid := make([]byte, 128)
+	copy(edid, edidHeader)
+	// DEL, product 0xA0C2
+	edid[8], edid[9] = 0x10, 0xac
+	edid[10], edid[11] = 0xc2, 0xa0
+	manufacturer, model := parseEDID(edid)
+	if manufacturer != "DEL" || model != "0xA0C2" {
+		t.Fatalf("parseEDID = %q %q", manufacturer, model)
+	}
+	desc := edid[72:90]
+	desc[3] = 0xfc
+	copy(desc[5:], "DELL U2415\n  ")
+	if _, model = parseEDID(edid); model != "DELL U2415" {
+		t.Fatalf("monitor name %q", model)
+	}
+	if manufacturer, model = parseEDID(edid[:100]); manufacturer != "" || model != "" {
+		t.Fatal("short EDID parsed")
+	}
+}
+
+func TestDisplayDPI(t *testing.T) {
+	display := Display{Bounds: image.Rect(0, 0, 1920, 1080), WidthMM: 527, HeightMM: 296}
+	x, y := display.DPI()
+	if int(x+0.5) != 93 || int(y+0.5) != 93 {
+		t.Fatalf("DPI = %f %f", x, y)
+	}
+	if x, y = (Display{}).DPI(); x != 0 || y != 0 {
+		t.Fatal("DPI of unknown size")
+	}
+}
@@ -0,0 +1,64 @@
+package dcap
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/diiyw/dcap/internal/clipboard"
+)
+
+var (
+	// ErrDisplayNotFound no display has the given index or name
+	ErrDisplayNotFound = errors.New("display not found")
+	// ErrUnknownKey key name missing from the keycode table
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrUnsupported feature not available on the system or server
+	ErrUnsupported = clipboard.ErrUnsupport
+	// ErrPermissionDenied access refused, e.g. X authorization or the
+	// screen recording permission of macOS
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrConnectionLost connection to the display server is closed
+	ErrConnectionLost = errors.New("connection lost")
+	// ErrClosed DCap used after Close
+	ErrClosed = errors.New("closed")
+	// ErrInvalidSize width or height of a capture is not positive
+	ErrInvalidSize = errors.New("invalid size")
+	// ErrNoData the clipboard has no data of the requested type
+	ErrNoData = clipboard.ErrNoData
+	// ErrOwnerTimeout the application owning the clipboard did not answer
+	// in time
+	ErrOwnerTimeout = clipboard.ErrOwnerTimeout
+	// ErrNotOwner the clipboard could not be taken over
+	ErrNotOwner = clipboard.ErrNotOwner
+)
+
+// Error failure of Op, Err is one of the sentinel errors when the kind of
+// failure is known and Cause the error of the system, errors.Is and
+// errors.As match both
+type Error struct {
+	Op    string
+	Err   error
+	Cause error
+}
+
+func (e *Error) Error() string {
+	var parts []string
+	for _, err := range e.Unwrap() {
+		parts = append(parts, err.Error())
+	}
+	if len(parts) == 0 {
+		return e.Op + " failed"
+	}
+	return e.Op + ": " + strings.Join(parts, ": ")
+}
+
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	if e.Cause != nil {
+		errs = append(errs, e.Cause)
+	}
+	return errs
+}
@@ -0,0 +1,38 @@
+package dcap
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/diiyw/dcap/internal/clipboard"
+	"github.com/jezek/xgb/xproto"
+)
+
+// xError wrap err of the X request op with the sentinel matching it
+func xError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{Op: op, Cause: err}
+	switch {
+	case errors.As(err, new(xproto.AccessError)),
+		strings.Contains(err.Error(), "authentication refused"):
+		e.Err = ErrPermissionDenied
+	case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed),
+		errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNRESET):
+		e.Err = ErrConnectionLost
+	}
+	return e
+}
+
+// clipboardError wrap err of the clipboard operation op like xError, the
+// clipboard has its own connection
+func clipboardError(op string, err error) error {
+	if errors.Is(err, clipboard.ErrClosed) {
+		return &Error{Op: op, Err: ErrConnectionLost, Cause: err}
+	}
+	return xError(op, err)
+}
@@ -0,0 +1,40 @@
+package dcap
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/diiyw/dcap/internal/clipboard"
+	"github.com/jezek/xgb/xproto"
+)
+
+func TestXError(t *testing.T) {
+	if xError("GetImage", nil) != nil {
+		t.Fatal("nil error wrapped")
+	}
+	if err := xError("GetImage", io.EOF); !errors.Is(err, ErrConnectionLost) || !errors.Is(err, io.EOF) {
+		t.Fatalf("EOF not a lost connection: %v", err)
+	}
+	if err := xError("WarpPointer", xproto.AccessError{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("BadAccess not a denied permission: %v", err)
+	}
+	if err := xError("GetImage", xproto.MatchError{}); errors.Is(err, ErrPermissionDenied) || errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("BadMatch classified: %v", err)
+	}
+}
+
+func TestClipboardError(t *testing.T) {
+	if clipboardError("get selection", nil) != nil {
+		t.Fatal("nil error wrapped")
+	}
+	if err := clipboardError("get selection", clipboard.ErrClosed); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("closed clipboard not a lost connection: %v", err)
+	}
+	if err := clipboardError("set selection", io.EOF); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("EOF not a lost connection: %v", err)
+	}
+	if err := clipboardError("get selection data", clipboard.ErrNoData); !errors.Is(err, ErrNoData) || errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("no data misclassified: %v", err)
+	}
+}
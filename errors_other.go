@@ -0,0 +1,11 @@
+//go:build !linux
+
+package dcap
+
+// clipboardError wrap err of the clipboard operation op
+func clipboardError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Cause: err}
+}
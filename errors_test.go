@@ -0,0 +1,49 @@
+package dcap
+
+import (
+	"errors"
+	"image"
+	"io"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	err := error(&Error{Op: "capture", Err: ErrConnectionLost, Cause: io.EOF})
+	if !errors.Is(err, ErrConnectionLost) || !errors.Is(err, io.EOF) {
+		t.Fatal("errors.Is does not match Err and Cause")
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Op != "capture" {
+		t.Fatal("errors.As does not match *Error")
+	}
+	if s := err.Error(); s != "capture: connection lost: EOF" {
+		t.Fatalf("message %q", s)
+	}
+	if s := (&Error{Op: "BitBlt"}).Error(); s != "BitBlt failed" {
+		t.Fatalf("message %q", s)
+	}
+}
+
+func TestInvalidSize(t *testing.T) {
+	d, err := NewDCapWithOptions(WithBackend(BackendHeadless))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err = d.CaptureScaled(d.Displays[0], 0, 90, Nearest); !errors.Is(err, ErrInvalidSize) {
+		t.Fatalf("zero width error %v", err)
+	}
+	// the size is checked before the backend, alike on every platform
+	for _, size := range []image.Point{{0, 10}, {10, 0}, {-10, 10}, {10, -10}} {
+		if err = d.Capture(0, 0, size.X, size.Y); !errors.Is(err, ErrInvalidSize) {
+			t.Fatalf("capture %v error %v", size, err)
+		}
+		rect := image.Rectangle{Max: size}
+		if err = d.CaptureInto(image.NewRGBA(image.Rect(0, 0, 10, 10)), rect); !errors.Is(err, ErrInvalidSize) {
+			t.Fatalf("capture into %v error %v", size, err)
+		}
+	}
+	if err = d.CaptureInto(image.NewRGBA(image.Rectangle{}), image.Rect(0, 0, 10, 10)); !errors.Is(err, ErrInvalidSize) {
+		t.Fatalf("capture into an empty image error %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package dcap
+
+import "image"
+
+// EventType type of Event
+type EventType byte
+
+const (
+	// DisplayAdded a display has been plugged in
+	DisplayAdded EventType = iota
+	// DisplayRemoved a display has been unplugged
+	DisplayRemoved
+	// DisplayResized a display has been resized or moved
+	DisplayResized
+	// ConnectionLost the connection to the display server is lost, Err
+	// tells why
+	ConnectionLost
+	// Reconnected the connection is open again, see WithReconnect
+	Reconnected
+)
+
+// String return name of event type
+func (t EventType) String() string {
+	switch t {
+	case DisplayAdded:
+		return "DisplayAdded"
+	case DisplayRemoved:
+		return "DisplayRemoved"
+	case DisplayResized:
+		return "DisplayResized"
+	case ConnectionLost:
+		return "ConnectionLost"
+	case Reconnected:
+		return "Reconnected"
+	}
+	return "Unknown"
+}
+
+// Event change of the displays or of the connection
+type Event struct {
+	Type EventType
+	// Index index of the display in Displays, its former index once removed
+	Index int
+	// Bounds bounds of the display, Old the bounds before the change
+	Bounds image.Rectangle
+	Old    image.Rectangle
+	// Err error wrapping ErrConnectionLost of ConnectionLost
+	Err error
+}
+
+// eventBuffer events kept while the receiver is not ready
+const eventBuffer = 16
+
+// Events return channel of display and connection changes, only Linux
+// reports them for now, events are dropped while the channel is full
+func (d *DCap) Events() <-chan Event {
+	return d.events
+}
+
+// CurrentDisplays return a copy of Displays, safe while they are refreshed
+func (d *DCap) CurrentDisplays() []image.Rectangle {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	displays := make([]image.Rectangle, len(d.Displays))
+	copy(displays, d.Displays)
+	return displays
+}
+
+// diffDisplays return the events turning old displays into displays
+func diffDisplays(old, displays []image.Rectangle) []Event {
+	var events []Event
+	for i, bounds := range displays {
+		switch {
+		case i >= len(old):
+			events = append(events, Event{Type: DisplayAdded, Index: i, Bounds: bounds})
+		case old[i] != bounds:
+			events = append(events, Event{Type: DisplayResized, Index: i, Bounds: bounds, Old: old[i]})
+		}
+	}
+	for i := len(displays); i < len(old); i++ {
+		events = append(events, Event{Type: DisplayRemoved, Index: i, Old: old[i]})
+	}
+	return events
+}
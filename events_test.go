@@ -0,0 +1,27 @@
+package dcap
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestDiffDisplays(t *testing.T) {
+	a := image.Rect(0, 0, 1920, 1080)
+	b := image.Rect(1920, 0, 3840, 1080)
+	c := image.Rect(1920, 0, 4480, 1440)
+	tests := []struct {
+		old, displays []image.Rectangle
+		want          []Event
+	}{
+		{[]image.Rectangle{a}, []image.Rectangle{a}, nil},
+		{[]image.Rectangle{a}, []image.Rectangle{a, b}, []Event{{Type: DisplayAdded, Index: 1, Bounds: b}}},
+		{[]image.Rectangle{a, b}, []image.Rectangle{a}, []Event{{Type: DisplayRemoved, Index: 1, Old: b}}},
+		{[]image.Rectangle{a, b}, []image.Rectangle{a, c}, []Event{{Type: DisplayResized, Index: 1, Bounds: c, Old: b}}},
+	}
+	for _, tt := range tests {
+		if got := diffDisplays(tt.old, tt.displays); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("diffDisplays(%v, %v) = %v, want %v", tt.old, tt.displays, got, tt.want)
+		}
+	}
+}
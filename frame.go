@@ -0,0 +1,101 @@
+package dcap
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"sync"
+	"time"
+)
+
+// Frame capture of one display
+type Frame struct {
+	Image *image.RGBA
+	// Index index of the display in Displays
+	Index   int
+	Display Display
+	// Time when the pixels were read
+	Time time.Time
+}
+
+// newFrames allocate frames of displays, every display when indices is
+// empty
+func (d *DCap) newFrames(indices []int) ([]Frame, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(indices) == 0 {
+		indices = make([]int, len(d.displays))
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+	frames := make([]Frame, len(indices))
+	for i, index := range indices {
+		if index < 0 || len(d.displays)-1 < index {
+			return nil, fmt.Errorf("%w: index %d out of range", ErrDisplayNotFound, index)
+		}
+		display := d.displays[index]
+		frames[i] = Frame{
+			Image:   image.NewRGBA(image.Rect(0, 0, display.Bounds.Dx(), display.Bounds.Dy())),
+			Index:   index,
+			Display: display,
+		}
+	}
+	return frames, nil
+}
+
+// captureDisplaysSerial capture the displays of frames one after another
+// once captureMu is taken, unless ctx is done first
+func (d *DCap) captureDisplaysSerial(ctx context.Context, indices []int) ([]Frame, error) {
+	frames, err := d.newFrames(indices)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.captureMu.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer d.captureMu.Unlock()
+	for i := range frames {
+		if err = d.captureInto(frames[i].Image, frames[i].Display.Bounds); err != nil {
+			return nil, err
+		}
+		frames[i].Time = time.Now()
+	}
+	return frames, nil
+}
+
+// FramePool recycle images for CaptureInto, the zero value is ready to use
+type FramePool struct {
+	mu    sync.Mutex
+	pools map[image.Point]*sync.Pool
+}
+
+// pool return pool of images of size
+func (p *FramePool) pool(size image.Point) *sync.Pool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pools == nil {
+		p.pools = make(map[image.Point]*sync.Pool)
+	}
+	pool, ok := p.pools[size]
+	if !ok {
+		pool = &sync.Pool{New: func() any {
+			return image.NewRGBA(image.Rectangle{Max: size})
+		}}
+		p.pools[size] = pool
+	}
+	return pool
+}
+
+// Get return an image of width x height, its content is undefined
+func (p *FramePool) Get(width, height int) *image.RGBA {
+	return p.pool(image.Pt(width, height)).Get().(*image.RGBA)
+}
+
+// Put give back an image returned by Get, sub-images are ignored
+func (p *FramePool) Put(im *image.RGBA) {
+	if im.Rect.Min != (image.Point{}) {
+		return
+	}
+	p.pool(im.Rect.Size()).Put(im)
+}
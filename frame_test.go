@@ -0,0 +1,22 @@
+package dcap
+
+import (
+	"image"
+	"testing"
+)
+
+func TestFramePool(t *testing.T) {
+	var pool FramePool
+	im := pool.Get(64, 32)
+	if im.Bounds() != image.Rect(0, 0, 64, 32) {
+		t.Fatalf("pool image bounds %v", im.Bounds())
+	}
+	pool.Put(im)
+	pool.Put(im.SubImage(image.Rect(1, 1, 65, 33)).(*image.RGBA))
+	if other := pool.Get(32, 64); other.Bounds() != image.Rect(0, 0, 32, 64) {
+		t.Fatalf("pool image bounds %v", other.Bounds())
+	}
+	if im = pool.Get(64, 32); im.Bounds() != image.Rect(0, 0, 64, 32) {
+		t.Fatalf("pool image bounds %v", im.Bounds())
+	}
+}
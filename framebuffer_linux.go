@@ -0,0 +1,126 @@
+package dcap
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// framebufferDevice device read by the framebuffer backend
+var framebufferDevice = "/dev/fb0"
+
+func init() {
+	backends[BackendFramebuffer] = newFramebuffer
+}
+
+// framebuffer backend reading a 32 bits per pixel framebuffer device, the
+// console without X, input is unsupported
+type framebuffer struct {
+	mu     sync.Mutex
+	file   *os.File
+	size   image.Point
+	stride int
+	buf    []byte
+}
+
+func newFramebuffer(o *options) (backend, error) {
+	sys := filepath.Join("/sys/class/graphics", filepath.Base(framebufferDevice))
+	size, err := readSysfsInts(filepath.Join(sys, "virtual_size"))
+	if err != nil {
+		return nil, err
+	}
+	bpp, err := readSysfsInts(filepath.Join(sys, "bits_per_pixel"))
+	if err != nil {
+		return nil, err
+	}
+	stride, err := readSysfsInts(filepath.Join(sys, "stride"))
+	if err != nil {
+		return nil, err
+	}
+	if len(size) != 2 || bpp[0] != 32 {
+		return nil, fmt.Errorf("%w: framebuffer of %d bits per pixel", ErrUnsupported, bpp[0])
+	}
+	file, err := os.Open(framebufferDevice)
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, &Error{Op: "open " + framebufferDevice, Err: ErrPermissionDenied, Cause: err}
+		}
+		return nil, err
+	}
+	return &framebuffer{file: file, size: image.Pt(size[0], size[1]), stride: stride[0]}, nil
+}
+
+// readSysfsInts read the comma separated integers of a sysfs attribute
+func readSysfsInts(name string) ([]int, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var ints []int
+	for _, field := range strings.Split(strings.TrimSpace(string(data)), ",") {
+		i, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+func (f *framebuffer) displays() ([]Display, error) {
+	displays := displaysFromBounds([]image.Rectangle{{Max: f.size}})
+	displays[0].Name = filepath.Base(framebufferDevice)
+	return displays, nil
+}
+
+// captureRaw read the rows of rect, the pixels are XRGB in little endian
+func (f *framebuffer) captureRaw(rect image.Rectangle, fn func(off image.Point, src pixels)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intersect := rect.Intersect(image.Rectangle{Max: f.size})
+	if intersect.Empty() {
+		return nil
+	}
+	rowSize := intersect.Dx() * 4
+	if len(f.buf) < rowSize*intersect.Dy() {
+		f.buf = make([]byte, rowSize*intersect.Dy())
+	}
+	for y := 0; y < intersect.Dy(); y++ {
+		offset := int64((intersect.Min.Y+y)*f.stride + intersect.Min.X*4)
+		if _, err := f.file.ReadAt(f.buf[y*rowSize:(y+1)*rowSize], offset); err != nil {
+			return err
+		}
+	}
+	fn(intersect.Min.Sub(rect.Min), pixels{pix: f.buf, stride: rowSize, size: intersect.Size()})
+	return nil
+}
+
+func (f *framebuffer) mouseMove(x, y int) error {
+	return fmt.Errorf("%w: input with the framebuffer backend", ErrUnsupported)
+}
+
+func (f *framebuffer) toggleMouse(button MouseButton, down bool) error {
+	return fmt.Errorf("%w: input with the framebuffer backend", ErrUnsupported)
+}
+
+func (f *framebuffer) toggleKey(key string, down bool) error {
+	return fmt.Errorf("%w: input with the framebuffer backend", ErrUnsupported)
+}
+
+func (f *framebuffer) scroll(x, y int) {}
+
+func (f *framebuffer) capabilities() Capabilities {
+	return Capabilities{Capture: true}
+}
+
+func (f *framebuffer) clipboard() clipboardBackend {
+	return noClipboard{backend: BackendFramebuffer}
+}
+
+func (f *framebuffer) close() error {
+	return f.file.Close()
+}
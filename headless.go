@@ -0,0 +1,290 @@
+package dcap
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+	"sync"
+
+	"github.com/diiyw/dcap/internal/clipboard"
+)
+
+// InputEventType kind of an InputEvent
+type InputEventType byte
+
+const (
+	// InputMouseMove pointer moved to Point
+	InputMouseMove InputEventType = iota
+	// InputMouseDown Button pressed at Point
+	InputMouseDown
+	// InputMouseUp Button released at Point
+	InputMouseUp
+	// InputKeyDown Key pressed
+	InputKeyDown
+	// InputKeyUp Key released
+	InputKeyUp
+	// InputScroll wheel turned by Scroll at Point
+	InputScroll
+)
+
+func (t InputEventType) String() string {
+	switch t {
+	case InputMouseMove:
+		return "move"
+	case InputMouseDown:
+		return "mouse down"
+	case InputMouseUp:
+		return "mouse up"
+	case InputKeyDown:
+		return "key down"
+	case InputKeyUp:
+		return "key up"
+	case InputScroll:
+		return "scroll"
+	}
+	return "unknown"
+}
+
+// InputEvent input injected into a Headless backend
+type InputEvent struct {
+	Type InputEventType
+	// Point pointer position when the event happened
+	Point  image.Point
+	Button MouseButton
+	Key    string
+	Scroll image.Point
+}
+
+func (e InputEvent) String() string {
+	switch e.Type {
+	case InputMouseDown, InputMouseUp:
+		return fmt.Sprintf("%s %d at %d,%d", e.Type, e.Button, e.Point.X, e.Point.Y)
+	case InputKeyDown, InputKeyUp:
+		return fmt.Sprintf("%s %s", e.Type, e.Key)
+	case InputScroll:
+		return fmt.Sprintf("%s %d,%d at %d,%d", e.Type, e.Scroll.X, e.Scroll.Y, e.Point.X, e.Point.Y)
+	}
+	return fmt.Sprintf("%s to %d,%d", e.Type, e.Point.X, e.Point.Y)
+}
+
+// Headless in memory backend for tests without a display server, the
+// screen is set by the test and injected input is recorded. Use it with
+// WithHeadless
+type Headless struct {
+	mu       sync.Mutex
+	screen   *image.RGBA
+	bounds   []image.Rectangle
+	pointer  image.Point
+	buttons  map[MouseButton]bool
+	keys     map[string]bool
+	events   []InputEvent
+	disabled bool
+	// board in memory clipboard shared by the DCaps of h
+	board *clipboard.Memory
+}
+
+// NewHeadless create a headless backend with displays in virtual desktop
+// coordinates, the first one is primary, a single 1920x1080 display when
+// none is given. The screen is black
+func NewHeadless(displays ...image.Rectangle) *Headless {
+	if len(displays) == 0 {
+		displays = []image.Rectangle{image.Rect(0, 0, 1920, 1080)}
+	}
+	var union image.Rectangle
+	for _, rect := range displays {
+		union = union.Union(rect)
+	}
+	screen := image.NewRGBA(union)
+	draw.Draw(screen, union, image.Black, image.Point{}, draw.Src)
+	return &Headless{
+		screen:  screen,
+		bounds:  append([]image.Rectangle(nil), displays...),
+		buttons: make(map[MouseButton]bool),
+		keys:    make(map[string]bool),
+		board:   clipboard.NewMemory(),
+	}
+}
+
+// SetScreen draw im onto the screen, im.Bounds() is in virtual desktop
+// coordinates
+func (h *Headless) SetScreen(im image.Image) {
+	h.mu.Lock()
+	draw.Draw(h.screen, im.Bounds(), im, im.Bounds().Min, draw.Src)
+	h.mu.Unlock()
+}
+
+// Pointer return the position of the pointer
+func (h *Headless) Pointer() image.Point {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pointer
+}
+
+// ButtonDown report if button is pressed
+func (h *Headless) ButtonDown(button MouseButton) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.buttons[button]
+}
+
+// KeyDown report if key is pressed
+func (h *Headless) KeyDown(key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.keys[key]
+}
+
+// Log return the injected input, oldest first
+func (h *Headless) Log() []InputEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]InputEvent(nil), h.events...)
+}
+
+// Clicks return where the button was pressed and released, in order
+func (h *Headless) Clicks(button MouseButton) []image.Point {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var clicks []image.Point
+	for i, ev := range h.events {
+		if ev.Type != InputMouseDown || ev.Button != button {
+			continue
+		}
+		for _, next := range h.events[i+1:] {
+			if next.Type == InputMouseUp && next.Button == button {
+				if next.Point == ev.Point {
+					clicks = append(clicks, ev.Point)
+				}
+				break
+			}
+		}
+	}
+	return clicks
+}
+
+// Typed return the single character keys pressed, in order
+func (h *Headless) Typed() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var typed strings.Builder
+	for _, ev := range h.events {
+		if ev.Type == InputKeyDown && len([]rune(ev.Key)) == 1 {
+			typed.WriteString(ev.Key)
+		}
+	}
+	return typed.String()
+}
+
+// Reset clear the log, the pointer and keyboard state are kept
+func (h *Headless) Reset() {
+	h.mu.Lock()
+	h.events = nil
+	h.mu.Unlock()
+}
+
+// SetInput enable or disable input, disabled input reports
+// ErrUnsupported like a server without XTest
+func (h *Headless) SetInput(enabled bool) {
+	h.mu.Lock()
+	h.disabled = !enabled
+	h.mu.Unlock()
+}
+
+// errHeadlessInput input disabled with SetInput
+var errHeadlessInput = fmt.Errorf("%w: input disabled", ErrUnsupported)
+
+// newHeadless return the Headless of WithHeadless or a new one
+func newHeadless(o *options) (backend, error) {
+	if o.headless != nil {
+		return o.headless, nil
+	}
+	return NewHeadless(), nil
+}
+
+// record log ev at the pointer, h.mu must be held
+func (h *Headless) record(ev InputEvent) {
+	ev.Point = h.pointer
+	h.events = append(h.events, ev)
+}
+
+func (h *Headless) displays() ([]Display, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return displaysFromBounds(h.bounds), nil
+}
+
+func (h *Headless) captureRaw(rect image.Rectangle, fn func(off image.Point, src pixels)) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	intersect := rect.Intersect(h.screen.Rect)
+	if intersect.Empty() {
+		return nil
+	}
+	i := h.screen.PixOffset(intersect.Min.X, intersect.Min.Y)
+	fn(intersect.Min.Sub(rect.Min), pixels{pix: h.screen.Pix[i:], stride: h.screen.Stride, size: intersect.Size(), rgba: true})
+	return nil
+}
+
+func (h *Headless) mouseMove(x, y int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.disabled {
+		return errHeadlessInput
+	}
+	h.pointer = image.Pt(x, y)
+	h.record(InputEvent{Type: InputMouseMove})
+	return nil
+}
+
+func (h *Headless) toggleMouse(button MouseButton, down bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	typ := InputMouseUp
+	if down {
+		typ = InputMouseDown
+	}
+	if h.disabled {
+		return errHeadlessInput
+	}
+	h.record(InputEvent{Type: typ, Button: button})
+	h.buttons[button] = down
+	return nil
+}
+
+func (h *Headless) toggleKey(key string, down bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	typ := InputKeyUp
+	if down {
+		typ = InputKeyDown
+	}
+	if h.disabled {
+		return errHeadlessInput
+	}
+	h.record(InputEvent{Type: typ, Key: key})
+	h.keys[key] = down
+	return nil
+}
+
+func (h *Headless) scroll(x, y int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.disabled {
+		h.record(InputEvent{Type: InputScroll, Scroll: image.Pt(x, y)})
+	}
+}
+
+func (h *Headless) capabilities() Capabilities {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return Capabilities{Capture: true, Input: !h.disabled, Clipboard: true}
+}
+
+func (h *Headless) clipboard() clipboardBackend {
+	return h.board
+}
+
+func (h *Headless) close() error {
+	return nil
+}
@@ -0,0 +1,117 @@
+package dcap
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestHeadlessInput(t *testing.T) {
+	h := NewHeadless()
+	d, err := NewDCapWithOptions(WithHeadless(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	_ = d.MouseMove(10, 20)
+	_ = d.ToggleMouse(MouseLeft, true)
+	_ = d.ToggleMouse(MouseLeft, false)
+	for _, key := range []string{"shift", "a", "b", "c"} {
+		_ = d.ToggleKey(key, true)
+		if key != "shift" {
+			_ = d.ToggleKey(key, false)
+		}
+	}
+	d.Scroll(0, -3)
+
+	if clicks := h.Clicks(MouseLeft); len(clicks) != 1 || clicks[0] != image.Pt(10, 20) {
+		t.Fatalf("clicks %v", clicks)
+	}
+	if typed := h.Typed(); typed != "abc" {
+		t.Fatalf("typed %q", typed)
+	}
+	if !h.KeyDown("shift") || h.KeyDown("a") || h.ButtonDown(MouseLeft) {
+		t.Fatal("keyboard or mouse state wrong")
+	}
+	log := h.Log()
+	if last := log[len(log)-1]; last.String() != "scroll 0,-3 at 10,20" {
+		t.Fatalf("last event %v", last)
+	}
+	h.Reset()
+	if len(h.Log()) != 0 || h.Pointer() != image.Pt(10, 20) {
+		t.Fatal("reset cleared the state or kept the log")
+	}
+
+	h.SetInput(false)
+	if err = d.MouseMove(0, 0); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("disabled input error %v", err)
+	}
+	if d.Capabilities().Input {
+		t.Fatal("disabled input reported")
+	}
+}
+
+func TestHeadlessScreen(t *testing.T) {
+	// a second display left of the primary one
+	h := NewHeadless(image.Rect(0, 0, 40, 30), image.Rect(-20, 0, 0, 30))
+	red := image.NewUniform(color.RGBA{R: 255, A: 255})
+	screen := image.NewRGBA(image.Rect(-20, 0, 0, 30))
+	draw.Draw(screen, screen.Rect, red, image.Point{}, draw.Src)
+	h.SetScreen(screen)
+
+	d, err := NewDCapWithOptions(WithHeadless(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if len(d.Displays) != 2 || !d.displays[0].Primary {
+		t.Fatalf("displays %v", d.Displays)
+	}
+	im, regions, err := d.CaptureAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := im.RGBAAt(regions[1].Min.X, 0); c.R != 255 {
+		t.Fatalf("left display pixel %v", c)
+	}
+	if c := im.RGBAAt(regions[0].Min.X, 0); c.R != 0 || c.A != 255 {
+		t.Fatalf("primary display pixel %v", c)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 4, 4))
+	if err = d.CaptureInto(gray, image.Rect(-2, 0, 2, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if gray.GrayAt(0, 0).Y == 0 || gray.GrayAt(3, 0).Y != 0 {
+		t.Fatal("gray capture across displays wrong")
+	}
+}
+
+func TestHeadlessClipboard(t *testing.T) {
+	h := NewHeadless()
+	d, err := NewDCapWithOptions(WithHeadless(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if !d.Capabilities().Clipboard {
+		t.Fatal("headless backend without clipboard")
+	}
+	if err = d.ClipboardSet("headless"); err != nil {
+		t.Fatal(err)
+	}
+	// the clipboard belongs to h, not to the DCap
+	d2, err := NewDCapWithOptions(WithHeadless(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d2.Close()
+	if text, err := d2.ClipboardGet(); err != nil || text != "headless" {
+		t.Fatalf("text %q, error %v", text, err)
+	}
+	if _, err = d2.ClipboardGetData("image/png"); !errors.Is(err, ErrNoData) {
+		t.Fatalf("error %v, want %v", err, ErrNoData)
+	}
+}
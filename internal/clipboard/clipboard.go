@@ -7,3 +7,76 @@ var Unsupported bool
 
 // ErrUnsupport unsupported error
 var ErrUnsupport = errors.New("unsupported")
+
+var (
+	// ErrNoData the selection owner refused to convert the selection to
+	// the target
+	ErrNoData = errors.New("clipboard: no data for target")
+	// ErrOwnerTimeout the selection owner did not answer in time
+	ErrOwnerTimeout = errors.New("clipboard: selection owner timed out")
+	// ErrNotOwner the selection could not be owned
+	ErrNotOwner = errors.New("clipboard: can not own selection")
+	// ErrClosed the connection of the clipboard is gone
+	ErrClosed = errors.New("clipboard: connection closed")
+)
+
+// Selection selection to read or write, only Clipboard exists outside X11
+type Selection byte
+
+const (
+	// Clipboard selection used by copy and paste
+	Clipboard Selection = iota
+	// Primary selection pasted with the middle button on X11
+	Primary
+	// Secondary selection of X11, rarely used
+	Secondary
+)
+
+// String return the X11 atom name of selection
+func (s Selection) String() string {
+	switch s {
+	case Primary:
+		return "PRIMARY"
+	case Secondary:
+		return "SECONDARY"
+	}
+	return "CLIPBOARD"
+}
+
+// Board clipboard of one display, the zero Board is the clipboard of the
+// default display
+type Board struct {
+	// Display X display, $DISPLAY when empty, only used on X11
+	Display string
+	// Xauthority authority file of Display, $XAUTHORITY when empty
+	Xauthority string
+}
+
+// Change change of the owner of a selection
+type Change struct {
+	Selection Selection
+	// Owner X11 window owning the selection, 0 if it has been released
+	Owner uint32
+	// Local true if the selection has been set by this process
+	Local bool
+	// Time X server timestamp of the change in milliseconds
+	Time uint32
+
+	board source
+}
+
+// source clipboard the new content of a Change is fetched from
+type source interface {
+	Get(sel Selection) (string, error)
+	GetData(sel Selection, target string) ([]byte, error)
+}
+
+// Text get the new selection text, it is only fetched when called
+func (c Change) Text() (string, error) {
+	return c.board.Get(c.Selection)
+}
+
+// Data get the new selection data of target, it is only fetched when called
+func (c Change) Data(target string) ([]byte, error) {
+	return c.board.GetData(c.Selection, target)
+}
@@ -8,6 +8,7 @@ package clipboard
 */
 import "C"
 import (
+	"context"
 	"errors"
 	"unsafe"
 )
@@ -17,7 +18,10 @@ func init() {
 }
 
 // Set set text to clipboard
-func Set(text string) error {
+func (Board) Set(sel Selection, text string) error {
+	if sel != Clipboard {
+		return ErrUnsupport
+	}
 	str := C.CString(text)
 	defer C.free(unsafe.Pointer(str))
 	if !C.set_clipboard(str) {
@@ -27,7 +31,62 @@ func Set(text string) error {
 }
 
 // Get get clipboard text
-func Get() (string, error) {
+func (Board) Get(sel Selection) (string, error) {
+	if sel != Clipboard {
+		return "", ErrUnsupport
+	}
 	str := C.get_clipboard()
 	return C.GoString(str), nil
 }
+
+// SetImage set PNG encoded image to clipboard
+func (Board) SetImage(sel Selection, png []byte) error {
+	return ErrUnsupport
+}
+
+// GetImage get PNG encoded image from clipboard
+func (Board) GetImage(sel Selection) ([]byte, error) {
+	return nil, ErrUnsupport
+}
+
+// Targets list the targets offered by the clipboard owner
+func (Board) Targets(sel Selection) ([]string, error) {
+	return nil, ErrUnsupport
+}
+
+// SetData set data to clipboard, one representation per target
+func (Board) SetData(sel Selection, items map[string][]byte) error {
+	return ErrUnsupport
+}
+
+// GetData get clipboard data of target
+func (Board) GetData(sel Selection, target string) ([]byte, error) {
+	return nil, ErrUnsupport
+}
+
+// Watch report owner changes of selections until ctx is done
+func (Board) Watch(ctx context.Context, sels ...Selection) (<-chan Change, error) {
+	return nil, ErrUnsupport
+}
+
+// ServeOwner do nothing, the system clipboard needs no owner
+func ServeOwner() {}
+
+// Acquire do nothing, the system clipboard is not closed
+func (Board) Acquire() {}
+
+// Release do nothing, the system clipboard keeps the data set after the
+// process exits
+func (Board) Release(persist, detach bool) error {
+	return nil
+}
+
+// Available report if the clipboard can be used
+func (Board) Available() bool {
+	return true
+}
+
+// Close do nothing, the system clipboard keeps the data set
+func (Board) Close() error {
+	return nil
+}
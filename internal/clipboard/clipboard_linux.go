@@ -3,6 +3,9 @@
 package clipboard
 
 import (
+	"bytes"
+	"context"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -13,19 +16,32 @@ const (
 )
 
 var (
-	copyArgs, pasteArgs []string
+	copyArgs, pasteArgs func(sel Selection) []string
+	// targets other than text are only supported by xclip
+	hasXclip bool
+)
 
-	xselCopyArgs  = []string{xsel, "--input", "--clipboard"}
-	xselPasteArgs = []string{xsel, "--output", "--clipboard"}
+func xselCopyArgs(sel Selection) []string {
+	return []string{xsel, "--input", "--" + strings.ToLower(sel.String())}
+}
 
-	xclipCopyArgs  = []string{xclip, "-in", "-selection", "clipboard"}
-	xclipPasteArgs = []string{xclip, "-out", "-selection", "clipboard"}
-)
+func xselPasteArgs(sel Selection) []string {
+	return []string{xsel, "--output", "--" + strings.ToLower(sel.String())}
+}
+
+func xclipCopyArgs(sel Selection) []string {
+	return []string{xclip, "-in", "-selection", strings.ToLower(sel.String())}
+}
+
+func xclipPasteArgs(sel Selection) []string {
+	return []string{xclip, "-out", "-selection", strings.ToLower(sel.String())}
+}
 
 func init() {
 	if _, err := exec.LookPath(xclip); err == nil {
 		copyArgs = xclipCopyArgs
 		pasteArgs = xclipPasteArgs
+		hasXclip = true
 		return
 	}
 	if _, err := exec.LookPath(xsel); err == nil {
@@ -36,25 +52,122 @@ func init() {
 	Unsupported = true
 }
 
-// Set set text to clipboard
-func Set(text string) error {
+// command return the command of args run on the display of b
+func (b Board) command(args []string) *exec.Cmd {
+	cmd := exec.Command(args[0], args[1:]...)
+	if env := b.env(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// env return the environment selecting the display of b in a child process
+func (b Board) env() []string {
+	var env []string
+	if b.Display != "" {
+		env = append(env, "DISPLAY="+b.Display)
+	}
+	if b.Xauthority != "" {
+		env = append(env, "XAUTHORITY="+b.Xauthority)
+	}
+	return env
+}
+
+// Set set text to selection, xclip or xsel are used when no X server can
+// be reached directly
+func (b Board) Set(sel Selection, text string) error {
+	if x := b.native(); x != nil {
+		return x.setText(sel, text)
+	}
 	if Unsupported {
 		return ErrUnsupport
 	}
-	cmd := exec.Command(copyArgs[0], copyArgs[1:]...)
+	cmd := b.command(copyArgs(sel))
 	cmd.Stdin = strings.NewReader(text)
 	return cmd.Run()
 }
 
-// Get get clipboard text
-func Get() (string, error) {
+// Get get selection text
+func (b Board) Get(sel Selection) (string, error) {
+	if x := b.native(); x != nil {
+		return x.getText(sel)
+	}
 	if Unsupported {
 		return "", ErrUnsupport
 	}
-	cmd := exec.Command(pasteArgs[0], pasteArgs[1:]...)
+	cmd := b.command(pasteArgs(sel))
 	data, err := cmd.Output()
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
+
+// SetImage set PNG encoded image to selection
+func (b Board) SetImage(sel Selection, png []byte) error {
+	return b.SetData(sel, map[string][]byte{"image/png": png})
+}
+
+// GetImage get PNG encoded image from selection
+func (b Board) GetImage(sel Selection) ([]byte, error) {
+	return b.GetData(sel, "image/png")
+}
+
+// Targets list the targets offered by the selection owner
+func (b Board) Targets(sel Selection) ([]string, error) {
+	if x := b.native(); x != nil {
+		return x.targets(sel)
+	}
+	data, err := b.GetData(sel, "TARGETS")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// SetData set data to selection, one representation per target, text
+// targets are also offered as UTF8_STRING and STRING
+func (b Board) SetData(sel Selection, items map[string][]byte) error {
+	if x := b.native(); x != nil {
+		return x.own(sel, withTextAliases(items))
+	}
+	// xclip can only offer a single target
+	if !hasXclip || len(items) != 1 {
+		return ErrUnsupport
+	}
+	for target, data := range items {
+		cmd := b.command(append(xclipCopyArgs(sel), "-t", target))
+		cmd.Stdin = bytes.NewReader(data)
+		return cmd.Run()
+	}
+	return nil
+}
+
+// GetData get selection data of target
+func (b Board) GetData(sel Selection, target string) ([]byte, error) {
+	if x := b.native(); x != nil {
+		return x.fetch(sel, target)
+	}
+	if !hasXclip {
+		return nil, ErrUnsupport
+	}
+	cmd := b.command(append(xclipPasteArgs(sel), "-t", target))
+	return cmd.Output()
+}
+
+// Watch report owner changes of selections until ctx is done or b is
+// released, a lost connection is opened again for the watchers. Changes are
+// dropped while the receiver is not ready
+func (b Board) Watch(ctx context.Context, sels ...Selection) (<-chan Change, error) {
+	x := b.native()
+	if x == nil {
+		return nil, ErrUnsupport
+	}
+	return x.watch(ctx, sels)
+}
+
+// Available report if the clipboard can be used, natively or with xclip
+// or xsel
+func (b Board) Available() bool {
+	return b.native() != nil || !Unsupported
+}
@@ -0,0 +1,227 @@
+package clipboard
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+const (
+	// ownerEnv marks the detached copy of the process serving selections
+	ownerEnv = "DCAP_CLIPBOARD_OWNER"
+	// saveTimeout bounds the copy of the clipboard by the clipboard manager
+	saveTimeout = 5 * time.Second
+)
+
+var errNoManager = errors.New("clipboard: no clipboard manager")
+
+// errNoOwnerHook detach needs ServeOwner to be called by the process
+var errNoOwnerHook = fmt.Errorf("%w: detached owner without ServeOwner", ErrUnsupport)
+
+// ownerHook set once ServeOwner has been called, the copy of the process
+// calls it too
+var ownerHook atomic.Bool
+
+// ServeOwner must be called first in main for the detached owner of
+// Release: the copy of the process started to serve the selections runs
+// the owner and exits, in any other process it returns at once
+func ServeOwner() {
+	ownerHook.Store(true)
+	if os.Getenv(ownerEnv) == "" {
+		return
+	}
+	os.Exit(runOwner(os.Stdin, os.Stdout))
+}
+
+// persist keep the selections owned by x available after the process
+// exits, CLIPBOARD is handed over to the clipboard manager, and with detach
+// a detached copy of the process serves the selections if no manager took
+// them
+func (x *x11) persist(detach bool) error {
+	err := x.save()
+	if err == nil {
+		return nil
+	}
+	if !detach {
+		if errors.Is(err, errNoManager) {
+			return nil
+		}
+		return err
+	}
+	return x.detach()
+}
+
+// save perform the SAVE_TARGETS handoff of CLIPBOARD to the clipboard
+// manager, the manager converts every target before answering
+func (x *x11) save() error {
+	selection, err := x.atom(Clipboard.String())
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	owned := x.data[selection]
+	list := make([]byte, 0, 4*len(owned))
+	for a := range owned {
+		list = binary.LittleEndian.AppendUint32(list, uint32(a))
+	}
+	x.mu.Unlock()
+	if owned == nil {
+		return nil
+	}
+
+	manager, err := x.atom("CLIPBOARD_MANAGER")
+	if err != nil {
+		return err
+	}
+	reply, err := xproto.GetSelectionOwner(x.conn, manager).Reply()
+	if err != nil {
+		return err
+	}
+	if reply.Owner == xproto.WindowNone {
+		return errNoManager
+	}
+	saveTargets, err := x.atom("SAVE_TARGETS")
+	if err != nil {
+		return err
+	}
+	property, err := x.atom("DCAP_SAVE_TARGETS")
+	if err != nil {
+		return err
+	}
+
+	x.getMu.Lock()
+	defer x.getMu.Unlock()
+	for len(x.notify) > 0 {
+		<-x.notify
+	}
+	xproto.ChangeProperty(x.conn, xproto.PropModeReplace, x.win, property,
+		xproto.AtomAtom, 32, uint32(len(list)/4), list)
+	xproto.ConvertSelection(x.conn, x.win, manager, saveTargets, property, xproto.TimeCurrentTime)
+	ev, err := x.wait(saveTimeout, func(ev xgb.Event) bool {
+		e, ok := ev.(xproto.SelectionNotifyEvent)
+		return ok && e.Selection == manager
+	})
+	if err != nil {
+		return err
+	}
+	if ev.(xproto.SelectionNotifyEvent).Property == xproto.AtomNone {
+		return errors.New("clipboard: clipboard manager refused the selection")
+	}
+	return nil
+}
+
+// snapshot copy the owned selections with their targets by name
+func (x *x11) snapshot() map[Selection]map[string][]byte {
+	snapshot := make(map[Selection]map[string][]byte)
+	for _, sel := range []Selection{Clipboard, Primary, Secondary} {
+		selection, err := x.atom(sel.String())
+		if err != nil {
+			continue
+		}
+		x.mu.Lock()
+		if owned, ok := x.data[selection]; ok {
+			items := make(map[string][]byte, len(owned))
+			for name, a := range x.atoms {
+				if data, ok := owned[a]; ok {
+					items[name] = data
+				}
+			}
+			snapshot[sel] = items
+		}
+		x.mu.Unlock()
+	}
+	return snapshot
+}
+
+// detach start a detached copy of the process owning the selections until
+// other clients take them
+func (x *x11) detach() error {
+	owned := x.snapshot()
+	if len(owned) == 0 {
+		return nil
+	}
+	// without the hook the copy would run the whole program
+	if !ownerHook.Load() {
+		return errNoOwnerHook
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe)
+	cmd.Env = append(append(os.Environ(), x.board.env()...), ownerEnv+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	err = gob.NewEncoder(stdin).Encode(owned)
+	_ = stdin.Close()
+	if err == nil {
+		// the owner acknowledges once it owns every selection
+		_, err = io.ReadFull(stdout, make([]byte, 1))
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+	// the owner outlives us in its own session, it is reaped if it exits
+	// first
+	go func() {
+		_ = cmd.Wait()
+	}()
+	return nil
+}
+
+// runOwner serve the selections read from r until they are all taken by
+// other clients, it is the body of the detached process
+func runOwner(r io.Reader, w io.Writer) int {
+	var owned map[Selection]map[string][]byte
+	if err := gob.NewDecoder(r).Decode(&owned); err != nil {
+		return 1
+	}
+	// the display of the parent is in the environment
+	x := Board{}.native()
+	if x == nil {
+		return 1
+	}
+	for sel, items := range owned {
+		if err := x.own(sel, items); err != nil {
+			return 1
+		}
+	}
+	if _, err := w.Write([]byte{1}); err != nil {
+		return 1
+	}
+	for {
+		select {
+		case <-x.lost:
+			x.mu.Lock()
+			n := len(x.data)
+			x.mu.Unlock()
+			if n == 0 {
+				return 0
+			}
+		case <-x.done:
+			return 0
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package clipboard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/diiyw/dcap/internal/xconn"
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+)
+
+// manager minimal clipboard manager which answers SAVE_TARGETS by fetching
+// every target with a single MULTIPLE request, like gnome-settings-daemon
+type manager struct {
+	t     *testing.T
+	conn  *xgb.Conn
+	win   xproto.Window
+	saved chan map[string][]byte
+}
+
+// startManager own CLIPBOARD_MANAGER on the test display
+func startManager(t *testing.T) *manager {
+	conn, _, err := xconn.Dial(os.Getenv("DISPLAY"), "")
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(conn.Close)
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	win, err := xproto.NewWindowId(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, win, screen.Root, 0, 0, 1, 1, 0,
+		xproto.WindowClassInputOutput, screen.RootVisual, 0, nil).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &manager{t: t, conn: conn, win: win, saved: make(chan map[string][]byte, 1)}
+	xproto.SetSelectionOwner(conn, win, m.atom("CLIPBOARD_MANAGER"), xproto.TimeCurrentTime)
+	go m.loop()
+	return m
+}
+
+func (m *manager) atom(name string) xproto.Atom {
+	reply, err := xproto.InternAtom(m.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0
+	}
+	return reply.Atom
+}
+
+func (m *manager) name(a xproto.Atom) string {
+	reply, err := xproto.GetAtomName(m.conn, a).Reply()
+	if err != nil {
+		return ""
+	}
+	return reply.Name
+}
+
+// convert convert CLIPBOARD to target into property and wait for the
+// answer, false if it is refused
+func (m *manager) convert(target, property xproto.Atom) bool {
+	xproto.ConvertSelection(m.conn, m.win, m.atom("CLIPBOARD"), target, property, xproto.TimeCurrentTime)
+	for {
+		ev, err := m.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return false
+		}
+		if e, ok := ev.(xproto.SelectionNotifyEvent); ok {
+			return e.Property != xproto.AtomNone
+		}
+	}
+}
+
+func (m *manager) property(property xproto.Atom) []byte {
+	reply, err := xproto.GetProperty(m.conn, true, m.win, property, xproto.GetPropertyTypeAny, 0, 1<<20).Reply()
+	if err != nil {
+		return nil
+	}
+	return reply.Value
+}
+
+// loop answer the first SAVE_TARGETS request
+func (m *manager) loop() {
+	for {
+		ev, err := m.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		e, ok := ev.(xproto.SelectionRequestEvent)
+		if !ok {
+			continue
+		}
+		m.saved <- m.save()
+		notify := xproto.SelectionNotifyEvent{
+			Time:      e.Time,
+			Requestor: e.Requestor,
+			Selection: e.Selection,
+			Target:    e.Target,
+			Property:  e.Property,
+		}
+		xproto.SendEvent(m.conn, false, e.Requestor, xproto.EventMaskNoEvent, string(notify.Bytes()))
+		xproto.GetInputFocus(m.conn).Reply()
+	}
+}
+
+// save fetch the targets of CLIPBOARD with MULTIPLE
+func (m *manager) save() map[string][]byte {
+	list := m.atom("DCAP_TEST_TARGETS")
+	if !m.convert(m.atom("TARGETS"), list) {
+		return nil
+	}
+	value := m.property(list)
+	var pairs []byte
+	var targets []xproto.Atom
+	for i := 0; i+4 <= len(value); i += 4 {
+		target := xproto.Atom(binary.LittleEndian.Uint32(value[i:]))
+		switch m.name(target) {
+		case "TARGETS", "MULTIPLE":
+			continue
+		}
+		property := m.atom("DCAP_TEST_" + string(rune('A'+len(targets))))
+		pairs = binary.LittleEndian.AppendUint32(pairs, uint32(target))
+		pairs = binary.LittleEndian.AppendUint32(pairs, uint32(property))
+		targets = append(targets, target)
+	}
+	// a missing target is answered with None
+	pairs = binary.LittleEndian.AppendUint32(pairs, uint32(m.atom("image/x-dcap-missing")))
+	pairs = binary.LittleEndian.AppendUint32(pairs, uint32(m.atom("DCAP_TEST_MISSING")))
+	multiple := m.atom("DCAP_TEST_MULTIPLE")
+	xproto.ChangeProperty(m.conn, xproto.PropModeReplace, m.win, multiple,
+		m.atom("ATOM_PAIR"), 32, uint32(len(pairs)/4), pairs)
+	if !m.convert(m.atom("MULTIPLE"), multiple) {
+		return nil
+	}
+	answer := m.property(multiple)
+	if len(answer) != len(pairs) || binary.LittleEndian.Uint32(answer[len(answer)-4:]) != 0 {
+		m.t.Errorf("MULTIPLE answer %v", answer)
+	}
+	saved := make(map[string][]byte)
+	for i, target := range targets {
+		property := xproto.Atom(binary.LittleEndian.Uint32(pairs[8*i+4:]))
+		saved[m.name(target)] = m.property(property)
+	}
+	return saved
+}
+
+func TestSave(t *testing.T) {
+	owner, _ := boards(t)
+	m := startManager(t)
+	if err := owner.SetData(Clipboard, map[string][]byte{"text/html": []byte("<b>saved</b>")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.native().save(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case saved := <-m.saved:
+		if string(saved["text/html"]) != "<b>saved</b>" {
+			t.Fatalf("saved %q", saved)
+		}
+		if stamp := saved["TIMESTAMP"]; len(stamp) != 4 || binary.LittleEndian.Uint32(stamp) == 0 {
+			t.Fatalf("timestamp %v", stamp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("manager did not save the clipboard")
+	}
+}
+
+func TestRunOwner(t *testing.T) {
+	_, requestor := boards(t)
+	var in bytes.Buffer
+	owned := map[Selection]map[string][]byte{Clipboard: {"text/plain": []byte("detached")}}
+	if err := gob.NewEncoder(&in).Encode(owned); err != nil {
+		t.Fatal(err)
+	}
+	r, w := io.Pipe()
+	exit := make(chan int, 1)
+	go func() {
+		exit <- runOwner(&in, w)
+	}()
+	t.Cleanup(func() {
+		_ = Board{}.Close()
+	})
+	// the owner acknowledges once it owns the selection
+	if _, err := io.ReadFull(r, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := requestor.GetData(Clipboard, "text/plain"); err != nil || string(text) != "detached" {
+		t.Fatalf("text %q: %v", text, err)
+	}
+	// it exits once the selection is taken
+	if err := requestor.Set(Clipboard, "taken"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case code := <-exit:
+		if code != 0 {
+			t.Fatalf("exit code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("owner still running")
+	}
+}
+
+func TestDetach(t *testing.T) {
+	owner, requestor := boards(t)
+	if err := owner.SetData(Clipboard, map[string][]byte{"text/plain": []byte("kept")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.native().detach(); err != nil {
+		t.Fatal(err)
+	}
+	// the copy of the test binary owns the selection once we are gone
+	if err := owner.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := requestor.GetData(Clipboard, "text/plain"); err != nil || string(text) != "kept" {
+		t.Fatalf("text %q: %v", text, err)
+	}
+	if err := requestor.Set(Clipboard, "taken"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -3,6 +3,7 @@
 package clipboard
 
 import (
+	"context"
 	"syscall"
 	"time"
 	"unsafe"
@@ -50,7 +51,10 @@ func waitOpenClipboard() error {
 }
 
 // Get get clipboard text
-func Get() (string, error) {
+func (Board) Get(sel Selection) (string, error) {
+	if sel != Clipboard {
+		return "", ErrUnsupport
+	}
 	// r, _, err := openClipboard.Call(0)
 	err := waitOpenClipboard()
 	if err != nil {
@@ -79,7 +83,10 @@ func Get() (string, error) {
 }
 
 // Set set text to clipboard
-func Set(text string) error {
+func (Board) Set(sel Selection, text string) error {
+	if sel != Clipboard {
+		return ErrUnsupport
+	}
 	err := waitOpenClipboard()
 	if err != nil {
 		return err
@@ -132,3 +139,55 @@ func Set(text string) error {
 	h = 0 // suppress deferred cleanup
 	return nil
 }
+
+// SetImage set PNG encoded image to clipboard
+func (Board) SetImage(sel Selection, png []byte) error {
+	return ErrUnsupport
+}
+
+// GetImage get PNG encoded image from clipboard
+func (Board) GetImage(sel Selection) ([]byte, error) {
+	return nil, ErrUnsupport
+}
+
+// Targets list the targets offered by the clipboard owner
+func (Board) Targets(sel Selection) ([]string, error) {
+	return nil, ErrUnsupport
+}
+
+// SetData set data to clipboard, one representation per target
+func (Board) SetData(sel Selection, items map[string][]byte) error {
+	return ErrUnsupport
+}
+
+// GetData get clipboard data of target
+func (Board) GetData(sel Selection, target string) ([]byte, error) {
+	return nil, ErrUnsupport
+}
+
+// Watch report owner changes of selections until ctx is done
+func (Board) Watch(ctx context.Context, sels ...Selection) (<-chan Change, error) {
+	return nil, ErrUnsupport
+}
+
+// ServeOwner do nothing, the system clipboard needs no owner
+func ServeOwner() {}
+
+// Acquire do nothing, the system clipboard is not closed
+func (Board) Acquire() {}
+
+// Release do nothing, the system clipboard keeps the data set after the
+// process exits
+func (Board) Release(persist, detach bool) error {
+	return nil
+}
+
+// Available report if the clipboard can be used
+func (Board) Available() bool {
+	return true
+}
+
+// Close do nothing, the system clipboard keeps the data set
+func (Board) Close() error {
+	return nil
+}
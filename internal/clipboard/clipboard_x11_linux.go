@@ -0,0 +1,958 @@
+package clipboard
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/diiyw/dcap/internal/xconn"
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xfixes"
+	"github.com/jezek/xgb/xproto"
+)
+
+const (
+	// incrChunk is the largest property written in one go, bigger payloads
+	// are sent with the INCR protocol.
+	incrChunk = 64 * 1024
+	// timeout bounds every wait for the selection owner.
+	timeout = 2 * time.Second
+	// retryMin and retryMax bound the wait before dialing again an X
+	// server which could not be reached.
+	retryMin = 100 * time.Millisecond
+	retryMax = 5 * time.Second
+)
+
+// textTargets are the targets served for plain text, the first one is
+// preferred when reading.
+var textTargets = []string{"UTF8_STRING", "text/plain;charset=utf-8", "text/plain", "STRING", "TEXT"}
+
+var (
+	nativeMu sync.Mutex
+	// natives native clipboards by board, a lost one stays until it is
+	// replaced so its watchers move to the new connection
+	natives = make(map[Board]*x11)
+	// failures failed dials by board, the next one waits for the backoff
+	failures = make(map[Board]dialFailure)
+	// users number of Acquire of each board not released yet
+	users = make(map[Board]int)
+)
+
+// dialFailure backoff of a board whose X server could not be reached
+type dialFailure struct {
+	delay time.Duration
+	next  time.Time
+}
+
+// native return the shared native X11 clipboard of the display of b, nil
+// if no X server can be reached, a lost connection is opened again
+func (b Board) native() *x11 {
+	nativeMu.Lock()
+	defer nativeMu.Unlock()
+	x := natives[b]
+	if x != nil && !x.closed() {
+		return x
+	}
+	return b.redial(x)
+}
+
+// redial open a new clipboard of b taking over the watchers of the lost
+// one, nil while the X server cannot be reached, a failed dial is only
+// tried again after a backoff. nativeMu must be held
+func (b Board) redial(lost *x11) *x11 {
+	f := failures[b]
+	if time.Now().Before(f.next) {
+		return nil
+	}
+	x, err := newX11(b)
+	if err != nil {
+		f.delay = min(max(2*f.delay, retryMin), retryMax)
+		f.next = time.Now().Add(f.delay)
+		failures[b] = f
+		return nil
+	}
+	delete(failures, b)
+	if lost != nil {
+		x.adopt(lost)
+	}
+	natives[b] = x
+	return x
+}
+
+// Acquire count a user of the clipboard of b, it stays open until every
+// user released it
+func (b Board) Acquire() {
+	nativeMu.Lock()
+	users[b]++
+	nativeMu.Unlock()
+}
+
+// Release release a user counted by Acquire. The last one closes the
+// clipboard, with persist the selections owned through b first go to the
+// clipboard manager, or with detach to a detached copy of the process
+func (b Board) Release(persist, detach bool) error {
+	nativeMu.Lock()
+	if users[b]--; users[b] > 0 {
+		nativeMu.Unlock()
+		return nil
+	}
+	delete(users, b)
+	x := natives[b]
+	delete(natives, b)
+	delete(failures, b)
+	nativeMu.Unlock()
+	if x == nil {
+		return nil
+	}
+	var err error
+	if persist {
+		err = within(saveTimeout+timeout, func() error {
+			return x.persist(detach)
+		})
+	}
+	return errors.Join(err, x.close())
+}
+
+// Close give up the selections owned through b and close its connection
+// whatever its users, the next call on b opens a new one
+func (b Board) Close() error {
+	nativeMu.Lock()
+	x := natives[b]
+	delete(natives, b)
+	nativeMu.Unlock()
+	if x == nil {
+		return nil
+	}
+	return x.close()
+}
+
+type incrKey struct {
+	requestor xproto.Window
+	property  xproto.Atom
+}
+
+type incrTransfer struct {
+	typ  xproto.Atom
+	data []byte
+}
+
+// watcher receiver of the owner changes of sels, it moves to the new
+// connection when the connection is lost
+type watcher struct {
+	sels []Selection
+	// selections sels by atom on the current connection
+	selections map[xproto.Atom]Selection
+	ch         chan Change
+
+	mu   sync.Mutex
+	done bool
+	// stop is closed with ch
+	stop chan struct{}
+}
+
+// send deliver change unless w is closed, dropped if the receiver is not
+// ready
+func (w *watcher) send(change Change) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return
+	}
+	select {
+	case w.ch <- change:
+	default:
+	}
+}
+
+// close close the channel of w, later calls do nothing
+func (w *watcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.done {
+		w.done = true
+		close(w.ch)
+		close(w.stop)
+	}
+}
+
+// closed report if w has been closed
+func (w *watcher) closed() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.done
+}
+
+// x11 implements the ICCCM selection protocol over its own connection, it
+// owns selections with an unmapped window and answers SelectionRequest
+// events from other clients.
+type x11 struct {
+	board Board
+	conn  *xgb.Conn
+	win   xproto.Window
+
+	mu    sync.Mutex
+	atoms map[string]xproto.Atom
+	// data of owned selections keyed by selection then target
+	data map[xproto.Atom]map[xproto.Atom][]byte
+	// times server time at which the selections have been owned
+	times map[xproto.Atom]xproto.Timestamp
+	incr  map[incrKey]*incrTransfer
+
+	// watchers of owner changes reported by XFixes
+	xfixes   bool
+	watched  map[xproto.Atom]bool
+	watchers map[*watcher]struct{}
+
+	// getMu serializes conversions, the event loop forwards their
+	// SelectionNotify and PropertyNotify events through notify.
+	getMu  sync.Mutex
+	notify chan xgb.Event
+
+	// lost is signaled when a selection is taken by another client, done
+	// is closed when the connection is gone, closing is set by close
+	lost    chan struct{}
+	done    chan struct{}
+	closing atomic.Bool
+}
+
+func newX11(b Board) (*x11, error) {
+	conn, _, err := xconn.Dial(b.Display, b.Xauthority)
+	if err != nil {
+		return nil, err
+	}
+	// selections are global to the display, any screen will do
+	screen := &xproto.Setup(conn).Roots[0]
+	win, err := xproto.NewWindowId(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, win, screen.Root, 0, 0, 1, 1, 0,
+		xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwEventMask, []uint32{xproto.EventMaskPropertyChange}).Check()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	x := &x11{
+		board:  b,
+		conn:   conn,
+		win:    win,
+		atoms:  make(map[string]xproto.Atom),
+		data:   make(map[xproto.Atom]map[xproto.Atom][]byte),
+		times:  make(map[xproto.Atom]xproto.Timestamp),
+		incr:   make(map[incrKey]*incrTransfer),
+		notify: make(chan xgb.Event, 16),
+		lost:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+
+		watched:  make(map[xproto.Atom]bool),
+		watchers: make(map[*watcher]struct{}),
+	}
+	if xfixes.Init(conn) == nil {
+		_, err = xfixes.QueryVersion(conn, 5, 0).Reply()
+		x.xfixes = err == nil
+	}
+	go x.loop()
+	return x, nil
+}
+
+// close release the selections still owned by x and close its connection
+func (x *x11) close() error {
+	x.closing.Store(true)
+	// the connection is closed anyway when the server does not answer,
+	// nothing is owned any more on a lost one
+	var err error
+	if !x.closed() {
+		err = within(timeout, x.release)
+	}
+	xconn.Close(x.conn)
+	// the watchers of a connection lost before are still open
+	x.closeWatchers()
+	return err
+}
+
+// within return the error of fn, or a timeout if it does not return within
+// d, fn is left to fail once the connection is closed
+func within(d time.Duration, fn func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		return fmt.Errorf("clipboard: %w", context.DeadlineExceeded)
+	}
+}
+
+// release give up the selections x still owns
+func (x *x11) release() error {
+	x.mu.Lock()
+	var owned []xproto.Atom
+	for selection := range x.data {
+		owned = append(owned, selection)
+	}
+	x.data = make(map[xproto.Atom]map[xproto.Atom][]byte)
+	x.mu.Unlock()
+
+	for _, selection := range owned {
+		// the selection may already belong to a clipboard manager or to
+		// the detached owner, only our own is cleared
+		reply, err := xproto.GetSelectionOwner(x.conn, selection).Reply()
+		if err != nil {
+			return err
+		}
+		if reply.Owner == x.win {
+			xproto.SetSelectionOwner(x.conn, xproto.WindowNone, selection, xproto.TimeCurrentTime)
+		}
+	}
+	// the round trip flushes the requests before the connection closes
+	_, err := xproto.GetInputFocus(x.conn).Reply()
+	return err
+}
+
+// atom intern atom by name with cache
+func (x *x11) atom(name string) (xproto.Atom, error) {
+	x.mu.Lock()
+	a, ok := x.atoms[name]
+	x.mu.Unlock()
+	if ok {
+		return a, nil
+	}
+	reply, err := xproto.InternAtom(x.conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return 0, err
+	}
+	x.mu.Lock()
+	x.atoms[name] = reply.Atom
+	x.mu.Unlock()
+	return reply.Atom, nil
+}
+
+func (x *x11) loop() {
+	defer func() {
+		// done is closed first, so a closed watcher finds x closed
+		close(x.done)
+		if x.closing.Load() {
+			x.closeWatchers()
+		} else {
+			go x.rewatch()
+		}
+	}()
+	for {
+		ev, err := x.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		switch e := ev.(type) {
+		case xproto.SelectionRequestEvent:
+			x.serve(e)
+		case xproto.SelectionClearEvent:
+			x.mu.Lock()
+			delete(x.data, e.Selection)
+			delete(x.times, e.Selection)
+			x.mu.Unlock()
+			select {
+			case x.lost <- struct{}{}:
+			default:
+			}
+		case xproto.SelectionNotifyEvent:
+			x.forward(e)
+		case xfixes.SelectionNotifyEvent:
+			x.broadcast(e)
+		case xproto.PropertyNotifyEvent:
+			if e.Window == x.win {
+				x.forward(e)
+			} else if e.State == xproto.PropertyDelete {
+				x.continueIncr(e)
+			}
+		}
+	}
+}
+
+// closed report if the connection of x is gone
+func (x *x11) closed() bool {
+	select {
+	case <-x.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeWatchers close the channels of the watchers, x has been closed
+func (x *x11) closeWatchers() {
+	for _, w := range x.takeWatchers() {
+		w.close()
+	}
+}
+
+// takeWatchers remove the watchers still open from x, no watcher can be
+// added afterwards
+func (x *x11) takeWatchers() []*watcher {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var watchers []*watcher
+	for w := range x.watchers {
+		if !w.closed() {
+			watchers = append(watchers, w)
+		}
+	}
+	x.watchers = nil
+	return watchers
+}
+
+// watching report if x has watchers still open
+func (x *x11) watching() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for w := range x.watchers {
+		if !w.closed() {
+			return true
+		}
+	}
+	return false
+}
+
+// rewatch reconnect the board of x whose connection is lost, until its
+// watchers are taken over by a new connection, closed or released with the
+// board
+func (x *x11) rewatch() {
+	for {
+		nativeMu.Lock()
+		if natives[x.board] != x || !x.watching() {
+			nativeMu.Unlock()
+			return
+		}
+		if x.board.redial(x) != nil {
+			nativeMu.Unlock()
+			return
+		}
+		wait := time.Until(failures[x.board].next)
+		nativeMu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// adopt subscribe the watchers of the lost clipboard on x
+func (x *x11) adopt(lost *x11) {
+	for _, w := range lost.takeWatchers() {
+		if err := x.subscribe(w); err != nil {
+			w.close()
+		}
+	}
+}
+
+// forward hand event to a pending conversion, dropped if nobody waits
+func (x *x11) forward(ev xgb.Event) {
+	select {
+	case x.notify <- ev:
+	default:
+	}
+}
+
+// broadcast owner change to the watchers of its selection
+func (x *x11) broadcast(e xfixes.SelectionNotifyEvent) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for w := range x.watchers {
+		if w.closed() {
+			delete(x.watchers, w)
+			continue
+		}
+		sel, ok := w.selections[e.Selection]
+		if !ok {
+			continue
+		}
+		w.send(Change{
+			Selection: sel,
+			Owner:     uint32(e.Owner),
+			Local:     e.Owner == x.win,
+			Time:      uint32(e.SelectionTimestamp),
+			board:     x.board,
+		})
+	}
+}
+
+// watch report owner changes of selections until ctx is done, or x is
+// closed
+func (x *x11) watch(ctx context.Context, sels []Selection) (<-chan Change, error) {
+	w := &watcher{
+		sels: sels,
+		ch:   make(chan Change, 8),
+		stop: make(chan struct{}),
+	}
+	if err := x.subscribe(w); err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.close()
+		case <-w.stop:
+		}
+	}()
+	return w.ch, nil
+}
+
+// subscribe select the owner changes of the selections of w on the
+// connection of x and add w to its watchers
+func (x *x11) subscribe(w *watcher) error {
+	if !x.xfixes {
+		return ErrUnsupport
+	}
+	selections := make(map[xproto.Atom]Selection, len(w.sels))
+	for _, sel := range w.sels {
+		a, err := x.atom(sel.String())
+		if err != nil {
+			return err
+		}
+		selections[a] = sel
+	}
+	mask := uint32(xfixes.SelectionEventMaskSetSelectionOwner |
+		xfixes.SelectionEventMaskSelectionWindowDestroy |
+		xfixes.SelectionEventMaskSelectionClientClose)
+	for a := range selections {
+		x.mu.Lock()
+		watched := x.watched[a]
+		x.watched[a] = true
+		x.mu.Unlock()
+		if watched {
+			continue
+		}
+		if err := xfixes.SelectSelectionInputChecked(x.conn, x.win, a, mask).Check(); err != nil {
+			x.mu.Lock()
+			delete(x.watched, a)
+			x.mu.Unlock()
+			return err
+		}
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.watchers == nil {
+		return ErrClosed
+	}
+	w.selections = selections
+	x.watchers[w] = struct{}{}
+	return nil
+}
+
+// serve answer a SelectionRequest from another client
+func (x *x11) serve(e xproto.SelectionRequestEvent) {
+	property := e.Property
+	if property == xproto.AtomNone {
+		// obsolete clients expect the target as property
+		property = e.Target
+	}
+	var ok bool
+	if multiple := x.known("MULTIPLE"); multiple != 0 && e.Target == multiple {
+		// the pairs are read from the property, there is none without it
+		ok = e.Property != xproto.AtomNone && x.convertMultiple(e.Requestor, e.Property, e.Selection)
+	} else {
+		ok = x.convert(e.Requestor, property, e.Selection, e.Target)
+	}
+	if !ok {
+		property = xproto.AtomNone
+	}
+	notify := xproto.SelectionNotifyEvent{
+		Time:      e.Time,
+		Requestor: e.Requestor,
+		Selection: e.Selection,
+		Target:    e.Target,
+		Property:  property,
+	}
+	xproto.SendEvent(x.conn, false, e.Requestor, xproto.EventMaskNoEvent, string(notify.Bytes()))
+}
+
+// known return the cached atom of name, 0 if it has not been interned
+func (x *x11) known(name string) xproto.Atom {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.atoms[name]
+}
+
+// convertMultiple answer a MULTIPLE request: property holds pairs of target
+// and property, each target is converted to its property, the property of
+// a pair which can not be converted is replaced by None
+func (x *x11) convertMultiple(requestor xproto.Window, property, selection xproto.Atom) bool {
+	reply, err := xproto.GetProperty(x.conn, false, requestor, property, xproto.GetPropertyTypeAny,
+		0, math.MaxUint32/4).Reply()
+	if err != nil || reply.Format != 32 {
+		return false
+	}
+	pairs := reply.Value[:len(reply.Value)/8*8]
+	for i := 0; i < len(pairs); i += 8 {
+		target := xproto.Atom(binary.LittleEndian.Uint32(pairs[i:]))
+		pair := xproto.Atom(binary.LittleEndian.Uint32(pairs[i+4:]))
+		if pair == xproto.AtomNone || target == x.known("MULTIPLE") ||
+			!x.convert(requestor, pair, selection, target) {
+			binary.LittleEndian.PutUint32(pairs[i+4:], uint32(xproto.AtomNone))
+		}
+	}
+	xproto.ChangeProperty(x.conn, xproto.PropModeReplace, requestor, property,
+		reply.Type, 32, uint32(len(pairs)/4), pairs)
+	return true
+}
+
+// convert write target data to the requestor property, false if the target
+// is not available
+func (x *x11) convert(requestor xproto.Window, property, selection, target xproto.Atom) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	owned, ok := x.data[selection]
+	if !ok {
+		return false
+	}
+	switch target {
+	case x.atoms["TARGETS"]:
+		list := make([]byte, 0, 4*(len(owned)+3))
+		for _, name := range []string{"TARGETS", "MULTIPLE", "TIMESTAMP"} {
+			list = binary.LittleEndian.AppendUint32(list, uint32(x.atoms[name]))
+		}
+		for a := range owned {
+			list = binary.LittleEndian.AppendUint32(list, uint32(a))
+		}
+		xproto.ChangeProperty(x.conn, xproto.PropModeReplace, requestor, property,
+			xproto.AtomAtom, 32, uint32(len(list)/4), list)
+		return true
+	case x.atoms["TIMESTAMP"]:
+		stamp := binary.LittleEndian.AppendUint32(nil, uint32(x.times[selection]))
+		xproto.ChangeProperty(x.conn, xproto.PropModeReplace, requestor, property,
+			xproto.AtomInteger, 32, 1, stamp)
+		return true
+	}
+	data, ok := owned[target]
+	if !ok {
+		return false
+	}
+	typ := target
+	if text := x.atoms["TEXT"]; text != 0 && target == text {
+		typ = x.atoms["UTF8_STRING"]
+	}
+	if len(data) > incrChunk {
+		incr := x.atoms["INCR"]
+		size := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+		xproto.ChangeWindowAttributes(x.conn, requestor, xproto.CwEventMask,
+			[]uint32{xproto.EventMaskPropertyChange})
+		xproto.ChangeProperty(x.conn, xproto.PropModeReplace, requestor, property, incr, 32, 1, size)
+		x.incr[incrKey{requestor, property}] = &incrTransfer{typ: typ, data: data}
+		return true
+	}
+	xproto.ChangeProperty(x.conn, xproto.PropModeReplace, requestor, property, typ, 8, uint32(len(data)), data)
+	return true
+}
+
+// continueIncr send the next INCR chunk once the requestor deleted the
+// previous one, a zero-length chunk ends the transfer
+func (x *x11) continueIncr(e xproto.PropertyNotifyEvent) {
+	key := incrKey{e.Window, e.Atom}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	t, ok := x.incr[key]
+	if !ok {
+		return
+	}
+	n := len(t.data)
+	if n > incrChunk {
+		n = incrChunk
+	}
+	xproto.ChangeProperty(x.conn, xproto.PropModeReplace, e.Window, e.Atom, t.typ, 8, uint32(n), t.data[:n])
+	t.data = t.data[n:]
+	if n == 0 {
+		delete(x.incr, key)
+		xproto.ChangeWindowAttributes(x.conn, e.Window, xproto.CwEventMask, []uint32{xproto.EventMaskNoEvent})
+	}
+}
+
+// own take ownership of the selection with data keyed by target
+func (x *x11) own(sel Selection, data map[string][]byte) error {
+	selection, err := x.atom(sel.String())
+	if err != nil {
+		return err
+	}
+	// atoms used while serving requests must be known beforehand
+	for _, name := range []string{"TARGETS", "MULTIPLE", "TIMESTAMP", "INCR", "UTF8_STRING", "TEXT"} {
+		if _, err = x.atom(name); err != nil {
+			return err
+		}
+	}
+	owned := make(map[xproto.Atom][]byte, len(data))
+	for name, b := range data {
+		a, err := x.atom(name)
+		if err != nil {
+			return err
+		}
+		owned[a] = b
+	}
+	// ICCCM forbids owning at CurrentTime, TIMESTAMP answers the time
+	stamp, err := x.serverTime()
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	x.data[selection] = owned
+	x.times[selection] = stamp
+	x.mu.Unlock()
+
+	xproto.SetSelectionOwner(x.conn, x.win, selection, stamp)
+	reply, err := xproto.GetSelectionOwner(x.conn, selection).Reply()
+	if err != nil {
+		return err
+	}
+	if reply.Owner != x.win {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// serverTime read the current server time from the PropertyNotify caused
+// by an empty append to our window
+func (x *x11) serverTime() (xproto.Timestamp, error) {
+	property, err := x.atom("DCAP_TIMESTAMP")
+	if err != nil {
+		return 0, err
+	}
+	x.getMu.Lock()
+	defer x.getMu.Unlock()
+	for len(x.notify) > 0 {
+		<-x.notify
+	}
+	xproto.ChangeProperty(x.conn, xproto.PropModeAppend, x.win, property, xproto.AtomString, 8, 0, nil)
+	ev, err := x.wait(timeout, func(ev xgb.Event) bool {
+		e, ok := ev.(xproto.PropertyNotifyEvent)
+		return ok && e.Atom == property
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ev.(xproto.PropertyNotifyEvent).Time, nil
+}
+
+// fetch convert the selection to target and read the result
+func (x *x11) fetch(sel Selection, target string) ([]byte, error) {
+	x.getMu.Lock()
+	defer x.getMu.Unlock()
+
+	selection, err := x.atom(sel.String())
+	if err != nil {
+		return nil, err
+	}
+	tgt, err := x.atom(target)
+	if err != nil {
+		return nil, err
+	}
+	property, err := x.atom("DCAP_SELECTION")
+	if err != nil {
+		return nil, err
+	}
+	incr, err := x.atom("INCR")
+	if err != nil {
+		return nil, err
+	}
+
+	// answer from our own data, the event loop would do the same
+	x.mu.Lock()
+	data, ok := x.data[selection][tgt]
+	x.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+
+	for len(x.notify) > 0 {
+		<-x.notify
+	}
+	xproto.ConvertSelection(x.conn, x.win, selection, tgt, property, xproto.TimeCurrentTime)
+	ev, err := x.wait(timeout, func(ev xgb.Event) bool {
+		e, ok := ev.(xproto.SelectionNotifyEvent)
+		return ok && e.Selection == selection
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ev.(xproto.SelectionNotifyEvent).Property == xproto.AtomNone {
+		return nil, ErrNoData
+	}
+
+	typ, data, err := x.readProperty(property)
+	if err != nil {
+		return nil, err
+	}
+	if typ != incr {
+		return data, nil
+	}
+	// the property has been deleted by readProperty, which starts the transfer
+	data = nil
+	for {
+		_, err = x.wait(timeout, func(ev xgb.Event) bool {
+			e, ok := ev.(xproto.PropertyNotifyEvent)
+			return ok && e.Atom == property && e.State == xproto.PropertyNewValue
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, chunk, err := x.readProperty(property)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) == 0 {
+			return data, nil
+		}
+		data = append(data, chunk...)
+	}
+}
+
+// wait for the first forwarded event matching fn
+func (x *x11) wait(d time.Duration, fn func(xgb.Event) bool) (xgb.Event, error) {
+	deadline := time.After(d)
+	for {
+		select {
+		case ev := <-x.notify:
+			if fn(ev) {
+				return ev, nil
+			}
+		case <-x.done:
+			return nil, ErrClosed
+		case <-deadline:
+			return nil, ErrOwnerTimeout
+		}
+	}
+}
+
+// readProperty read and delete property of our window
+func (x *x11) readProperty(property xproto.Atom) (xproto.Atom, []byte, error) {
+	var (
+		typ    xproto.Atom
+		data   []byte
+		offset uint32
+	)
+	for {
+		reply, err := xproto.GetProperty(x.conn, true, x.win, property,
+			xproto.GetPropertyTypeAny, offset, 1<<16).Reply()
+		if err != nil {
+			return 0, nil, err
+		}
+		typ = reply.Type
+		data = append(data, reply.Value...)
+		if reply.BytesAfter == 0 {
+			return typ, data, nil
+		}
+		offset += uint32(len(reply.Value) / 4)
+	}
+}
+
+// setText own the selection with text for every text target
+func (x *x11) setText(sel Selection, text string) error {
+	return x.own(sel, withTextAliases(map[string][]byte{"UTF8_STRING": []byte(text)}))
+}
+
+// getText read the selection as text
+func (x *x11) getText(sel Selection) (string, error) {
+	data, err := x.fetch(sel, "UTF8_STRING")
+	if errors.Is(err, ErrNoData) {
+		// owners predating UTF8_STRING only offer Latin-1
+		data, err = x.fetch(sel, "STRING")
+		data = fromLatin1(data)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// targets list the targets of the selection owner
+func (x *x11) targets(sel Selection) ([]string, error) {
+	selection, err := x.atom(sel.String())
+	if err != nil {
+		return nil, err
+	}
+	x.mu.Lock()
+	if owned, ok := x.data[selection]; ok {
+		names := make([]string, 0, len(owned))
+		for name, a := range x.atoms {
+			if _, ok := owned[a]; ok {
+				names = append(names, name)
+			}
+		}
+		x.mu.Unlock()
+		sort.Strings(names)
+		return names, nil
+	}
+	x.mu.Unlock()
+
+	data, err := x.fetch(sel, "TARGETS")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(data)/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		a := xproto.Atom(binary.LittleEndian.Uint32(data[i:]))
+		reply, err := xproto.GetAtomName(x.conn, a).Reply()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, reply.Name)
+	}
+	return names, nil
+}
+
+// withTextAliases offer text under every text target, STRING is Latin-1
+// and left out when the text has characters outside of it
+func withTextAliases(items map[string][]byte) map[string][]byte {
+	var text []byte
+	for _, t := range textTargets {
+		if data, ok := items[t]; ok {
+			text = data
+			if t == "STRING" {
+				text = fromLatin1(data)
+			}
+			break
+		}
+	}
+	if text == nil {
+		return items
+	}
+	out := make(map[string][]byte, len(items)+len(textTargets))
+	for _, t := range textTargets {
+		if t != "STRING" {
+			out[t] = text
+		} else if data, ok := toLatin1(text); ok {
+			out[t] = data
+		}
+	}
+	for target, data := range items {
+		out[target] = data
+	}
+	return out
+}
+
+// toLatin1 encode UTF-8 text in ISO 8859-1, the encoding of STRING, false
+// if a character has no Latin-1 code
+func toLatin1(text []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(text))
+	for _, r := range string(text) {
+		// invalid UTF-8 decodes to RuneError, above 0xff too
+		if r > 0xff {
+			return nil, false
+		}
+		out = append(out, byte(r))
+	}
+	return out, true
+}
+
+// fromLatin1 decode ISO 8859-1 text to UTF-8
+func fromLatin1(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, c := range data {
+		out = utf8.AppendRune(out, rune(c))
+	}
+	return out
+}
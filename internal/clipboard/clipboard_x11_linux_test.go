@@ -0,0 +1,240 @@
+package clipboard
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMain run the tests on a private Xvfb when there is no desktop
+func TestMain(m *testing.M) {
+	// the detached owner of TestDetach is a copy of the test binary
+	ServeOwner()
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("Xvfb"); err == nil && os.Getenv("DISPLAY") == "" {
+		var display string
+		cmd, display, err = startXvfb()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Setenv("DISPLAY", display)
+	}
+	code := m.Run()
+	if cmd != nil {
+		_ = cmd.Process.Signal(syscall.SIGTERM)
+		_ = cmd.Wait()
+	}
+	os.Exit(code)
+}
+
+// startXvfb start Xvfb on a free display and return its name once it is
+// ready
+func startXvfb() (*exec.Cmd, string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+	cmd := exec.Command("Xvfb", "-displayfd", "3", "-nolisten", "tcp")
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	line, _ := bufio.NewReader(r).ReadString('\n')
+	if line = strings.TrimSpace(line); line == "" {
+		_ = cmd.Wait()
+		return nil, "", fmt.Errorf("Xvfb exited before accepting connections")
+	}
+	return cmd, ":" + line, nil
+}
+
+// boards return two Boards of the test display with their own connection,
+// so data goes through the server between them
+func boards(t *testing.T) (Board, Board) {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		t.Skip("no X display")
+	}
+	// the same display named with and without its screen
+	owner := Board{Display: display}
+	requestor := Board{Display: display + ".0"}
+	if i := strings.LastIndex(display, "."); i > strings.LastIndex(display, ":") {
+		requestor = Board{Display: display[:i]}
+	}
+	if owner.native() == nil || requestor.native() == nil {
+		t.Skip("X server not reachable")
+	}
+	t.Cleanup(func() {
+		_ = owner.Close()
+		_ = requestor.Close()
+	})
+	return owner, requestor
+}
+
+func TestTransfer(t *testing.T) {
+	owner, requestor := boards(t)
+	if owner.native() == requestor.native() {
+		t.Fatal("boards share their connection")
+	}
+
+	// larger than incrChunk, it is sent with INCR
+	payload := make([]byte, 3*incrChunk+123)
+	rand.New(rand.NewSource(1)).Read(payload)
+	const target = "application/x-dcap-test"
+	if err := owner.SetData(Clipboard, map[string][]byte{target: payload, "text/plain": []byte("small")}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := requestor.GetData(Clipboard, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Fatalf("received %d bytes, want %d", len(data), len(payload))
+	}
+
+	targets, err := requestor.Targets(Clipboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(targets)
+	for _, want := range []string{"TARGETS", "UTF8_STRING", target} {
+		if i := sort.SearchStrings(targets, want); i == len(targets) || targets[i] != want {
+			t.Fatalf("targets %v miss %s", targets, want)
+		}
+	}
+	text, err := requestor.Get(Clipboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "small" {
+		t.Fatalf("text %q", text)
+	}
+	if _, err = requestor.GetData(Clipboard, "image/png"); err == nil {
+		t.Fatal("missing target converted")
+	}
+}
+
+func TestWatchReconnect(t *testing.T) {
+	owner, requestor := boards(t)
+	ch, err := owner.Watch(context.Background(), Clipboard)
+	if err != nil {
+		t.Skip(err)
+	}
+	// drop the connection behind the back of the Board
+	x := owner.native()
+	x.conn.Close()
+	<-x.done
+	// the watcher moves to a new connection
+	deadline := time.Now().Add(5 * time.Second)
+	for owner.native() == x || owner.native() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no new connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = requestor.Set(Clipboard, "again"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case change, ok := <-ch:
+			if !ok {
+				t.Fatal("watcher closed with its connection")
+			}
+			if !change.Local && change.Owner != 0 {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change after the reconnection")
+		}
+	}
+}
+
+func TestRedialBackoff(t *testing.T) {
+	b := Board{Display: ":4242"}
+	t.Cleanup(func() {
+		nativeMu.Lock()
+		delete(failures, b)
+		nativeMu.Unlock()
+	})
+	if b.native() != nil {
+		t.Skip("display :4242 exists")
+	}
+	nativeMu.Lock()
+	f := failures[b]
+	nativeMu.Unlock()
+	if f.delay != retryMin {
+		t.Fatalf("delay %v, want %v", f.delay, retryMin)
+	}
+	// the failure is not cached forever, but the next dial waits
+	if b.native() != nil {
+		t.Fatal("display :4242 appeared")
+	}
+	nativeMu.Lock()
+	if failures[b] != f {
+		t.Fatal("dialed again before the backoff")
+	}
+	failures[b] = dialFailure{delay: f.delay}
+	nativeMu.Unlock()
+	b.native()
+	nativeMu.Lock()
+	f = failures[b]
+	nativeMu.Unlock()
+	if f.delay != 2*retryMin {
+		t.Fatalf("delay %v, want %v", f.delay, 2*retryMin)
+	}
+}
+
+func TestTextAliases(t *testing.T) {
+	items := withTextAliases(map[string][]byte{"UTF8_STRING": []byte("caf\u00e9")})
+	if !bytes.Equal(items["STRING"], []byte("caf\xe9")) {
+		t.Fatalf("STRING %q, want Latin-1", items["STRING"])
+	}
+	if string(items["TEXT"]) != "caf\u00e9" {
+		t.Fatalf("TEXT %q", items["TEXT"])
+	}
+	// no Latin-1 code for the euro sign
+	items = withTextAliases(map[string][]byte{"UTF8_STRING": []byte("5 \u20ac")})
+	if _, ok := items["STRING"]; ok {
+		t.Fatal("STRING offered for text outside Latin-1")
+	}
+	items = withTextAliases(map[string][]byte{"STRING": []byte("caf\xe9")})
+	if string(items["UTF8_STRING"]) != "caf\u00e9" {
+		t.Fatalf("UTF8_STRING %q, want the decoded STRING", items["UTF8_STRING"])
+	}
+}
+
+func TestRelease(t *testing.T) {
+	owner, requestor := boards(t)
+	owner.Acquire()
+	owner.Acquire()
+	if err := owner.Set(Clipboard, "shared"); err != nil {
+		t.Fatal(err)
+	}
+	// another user is left, the selection stays owned
+	if err := owner.Release(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := requestor.Get(Clipboard); err != nil || text != "shared" {
+		t.Fatalf("text %q after the first release: %v", text, err)
+	}
+	if err := owner.Release(false, false); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := requestor.Get(Clipboard); err == nil && text == "shared" {
+		t.Fatal("selection kept after the last release")
+	}
+}
@@ -0,0 +1,142 @@
+package clipboard
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryText targets of the text of a Memory, the first one is set
+var memoryText = []string{"text/plain;charset=utf-8", "text/plain"}
+
+// Memory in memory clipboard without a system behind it, its selections
+// only live as long as it does
+type Memory struct {
+	mu       sync.Mutex
+	data     map[Selection]map[string][]byte
+	watchers map[*memoryWatcher]struct{}
+}
+
+type memoryWatcher struct {
+	selections map[Selection]bool
+	ch         chan Change
+}
+
+// NewMemory create an empty in memory clipboard
+func NewMemory() *Memory {
+	return &Memory{
+		data:     make(map[Selection]map[string][]byte),
+		watchers: make(map[*memoryWatcher]struct{}),
+	}
+}
+
+// Set set text to selection
+func (m *Memory) Set(sel Selection, text string) error {
+	return m.SetData(sel, map[string][]byte{memoryText[0]: []byte(text)})
+}
+
+// Get get text from selection
+func (m *Memory) Get(sel Selection) (string, error) {
+	for _, target := range memoryText {
+		if data, err := m.GetData(sel, target); err == nil {
+			return string(data), nil
+		}
+	}
+	return "", ErrNoData
+}
+
+// SetImage set PNG image to selection
+func (m *Memory) SetImage(sel Selection, png []byte) error {
+	return m.SetData(sel, map[string][]byte{"image/png": png})
+}
+
+// GetImage get PNG image from selection
+func (m *Memory) GetImage(sel Selection) ([]byte, error) {
+	return m.GetData(sel, "image/png")
+}
+
+// Targets list the targets of selection
+func (m *Memory) Targets(sel Selection) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	targets := make([]string, 0, len(m.data[sel]))
+	for target := range m.data[sel] {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+// SetData replace selection with items keyed by target
+func (m *Memory) SetData(sel Selection, items map[string][]byte) error {
+	owned := make(map[string][]byte, len(items))
+	for target, data := range items {
+		owned[target] = append([]byte(nil), data...)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[sel] = owned
+	change := Change{
+		Selection: sel,
+		Local:     true,
+		Time:      uint32(time.Now().UnixMilli()),
+		board:     m,
+	}
+	for w := range m.watchers {
+		if !w.selections[sel] {
+			continue
+		}
+		select {
+		case w.ch <- change:
+		default:
+		}
+	}
+	return nil
+}
+
+// GetData get selection data of target
+func (m *Memory) GetData(sel Selection, target string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[sel][target]
+	if !ok {
+		return nil, ErrNoData
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Watch report the changes of selections until ctx is done
+func (m *Memory) Watch(ctx context.Context, sels ...Selection) (<-chan Change, error) {
+	w := &memoryWatcher{
+		selections: make(map[Selection]bool, len(sels)),
+		ch:         make(chan Change, 8),
+	}
+	for _, sel := range sels {
+		w.selections[sel] = true
+	}
+	m.mu.Lock()
+	m.watchers[w] = struct{}{}
+	m.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.watchers, w)
+		close(w.ch)
+		m.mu.Unlock()
+	}()
+	return w.ch, nil
+}
+
+// Acquire do nothing, m is not closed
+func (m *Memory) Acquire() {}
+
+// Release do nothing, the selections stay in m
+func (m *Memory) Release(persist, detach bool) error {
+	return nil
+}
+
+// Available report if the clipboard can be used
+func (m *Memory) Available() bool {
+	return true
+}
@@ -0,0 +1,49 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	if _, err := m.Get(Clipboard); !errors.Is(err, ErrNoData) {
+		t.Fatalf("error %v, want %v", err, ErrNoData)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := m.Watch(ctx, Clipboard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Set(Primary, "primary"); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.SetData(Clipboard, map[string][]byte{"text/plain": []byte("text"), "text/html": []byte("<b>text</b>")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case change := <-ch:
+		if change.Selection != Clipboard || !change.Local {
+			t.Fatalf("change %+v", change)
+		}
+		if text, err := change.Text(); err != nil || text != "text" {
+			t.Fatalf("text %q, %v", text, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no change")
+	}
+	if targets, _ := m.Targets(Clipboard); !reflect.DeepEqual(targets, []string{"text/html", "text/plain"}) {
+		t.Fatalf("targets %v", targets)
+	}
+	if text, err := m.Get(Primary); err != nil || text != "primary" {
+		t.Fatalf("primary %q, %v", text, err)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
@@ -0,0 +1,310 @@
+// Package xconn connect to X servers named by a display string without
+// relying on $DISPLAY and $XAUTHORITY, which is all xgb supports
+package xconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jezek/xgb"
+)
+
+// families of the Xauthority entries, see Xauth.h
+const (
+	familyInternet  = 0
+	familyInternet6 = 6
+	familyLocal     = 256
+	familyWild      = 65535
+)
+
+const authName = "MIT-MAGIC-COOKIE-1"
+
+var (
+	socketsMu sync.Mutex
+	// sockets socket of each open connection, for Close
+	sockets = make(map[*xgb.Conn]*authConn)
+
+	loggerMu sync.Mutex
+	// quiet number of setups in progress silencing xgb.Logger
+	quiet int
+	// output writer of xgb.Logger restored after the setups
+	output io.Writer
+)
+
+// Display parsed display name such as :1, :1.0, host:1, tcp/host:1 or
+// /path/to/socket:1
+type Display struct {
+	// Protocol tcp, inet, inet6 or unix, empty when not given
+	Protocol string
+	// Host host name, empty for the local server
+	Host string
+	// Socket path of a unix socket given by the name
+	Socket string
+	// Number display number
+	Number int
+	// Screen screen number, 0 when not given
+	Screen int
+}
+
+// Parse parse a display name, $DISPLAY when name is empty
+func Parse(name string) (Display, error) {
+	if name == "" {
+		name = os.Getenv("DISPLAY")
+	}
+	if name == "" {
+		return Display{}, errors.New("empty display name")
+	}
+	colon := strings.LastIndex(name, ":")
+	if colon < 0 {
+		return Display{}, fmt.Errorf("bad display name: %s", name)
+	}
+	var d Display
+	host, rest := name[:colon], name[colon+1:]
+	if strings.HasPrefix(host, "/") {
+		d.Socket = name
+	} else {
+		if slash := strings.LastIndex(host, "/"); slash >= 0 {
+			d.Protocol, host = host[:slash], host[slash+1:]
+		}
+		// IPv6 addresses may be bracketed, e.g. inet6/[::1]:1
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+		if host != "unix" {
+			d.Host = host
+		} else if d.Protocol == "" {
+			d.Protocol = "unix"
+		}
+	}
+	number, screen, hasScreen := strings.Cut(rest, ".")
+	var err error
+	if d.Number, err = strconv.Atoi(number); err != nil || d.Number < 0 {
+		return Display{}, fmt.Errorf("bad display name: %s", name)
+	}
+	if hasScreen {
+		if d.Screen, err = strconv.Atoi(screen); err != nil || d.Screen < 0 {
+			return Display{}, fmt.Errorf("bad display name: %s", name)
+		}
+	}
+	return d, nil
+}
+
+// local report if the server is reached over a unix socket
+func (d Display) local() bool {
+	return d.Socket != "" || d.Host == "" && (d.Protocol == "" || d.Protocol == "unix")
+}
+
+// dial open the socket of the server, local servers are tried on their
+// abstract socket first like libxcb does
+func (d Display) dial() (net.Conn, error) {
+	number := strconv.Itoa(d.Number)
+	if d.Socket != "" {
+		return net.Dial("unix", d.Socket)
+	}
+	if d.local() {
+		conn, err := net.Dial("unix", "@/tmp/.X11-unix/X"+number)
+		if err == nil {
+			return conn, nil
+		}
+		return net.Dial("unix", "/tmp/.X11-unix/X"+number)
+	}
+	network := "tcp"
+	switch d.Protocol {
+	case "inet":
+		network = "tcp4"
+	case "inet6":
+		network = "tcp6"
+	}
+	return net.Dial(network, net.JoinHostPort(d.Host, strconv.Itoa(6000+d.Number)))
+}
+
+// Dial connect to the display name, $DISPLAY when empty, authorized by the
+// Xauthority file, $XAUTHORITY or ~/.Xauthority when empty. It returns the
+// screen of the name.
+//
+// xgb still reads $XAUTHORITY before the setup, its entries are ignored
+// except one without display number and of another protocol than
+// MIT-MAGIC-COOKIE-1, which xgb refuses with "unsupported auth protocol"
+func Dial(name, xauthority string) (*xgb.Conn, int, error) {
+	d, err := Parse(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	conn, err := d.dial()
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot connect to %s: %w", name, err)
+	}
+	family, address := familyLocal, []byte(nil)
+	if tcp, ok := conn.RemoteAddr().(*net.TCPAddr); ok && !tcp.IP.IsLoopback() {
+		if ip := tcp.IP.To4(); ip != nil {
+			family, address = familyInternet, ip
+		} else {
+			family, address = familyInternet6, tcp.IP.To16()
+		}
+	}
+	if family == familyLocal {
+		host, err := os.Hostname()
+		if err != nil {
+			conn.Close()
+			return nil, 0, err
+		}
+		address = []byte(host)
+	}
+	// a missing entry is tried without authorization
+	data, _ := readAuthority(xauthority, uint16(family), address, strconv.Itoa(d.Number))
+	sock := &authConn{Conn: conn, data: data}
+	restore := quietLogger()
+	c, err := xgb.NewConnNet(sock)
+	restore()
+	if err != nil {
+		conn.Close()
+		return nil, 0, err
+	}
+	socketsMu.Lock()
+	sock.xgb = c
+	sockets[c] = sock
+	socketsMu.Unlock()
+	return c, d.Screen, nil
+}
+
+// Close close c without waiting for the server: xgb's Close makes a round
+// trip first, which never ends when the server hangs. Closing the socket
+// makes the pending requests fail with io.EOF at once
+func Close(c *xgb.Conn) {
+	socketsMu.Lock()
+	sock := sockets[c]
+	socketsMu.Unlock()
+	c.Close()
+	if sock != nil {
+		_ = sock.Close()
+	}
+}
+
+// quietLogger silence xgb.Logger until restore is called, xgb logs that it
+// found no authority of $DISPLAY on every setup while the data of the
+// display dialed is written by authConn
+func quietLogger() (restore func()) {
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	if quiet == 0 {
+		output = xgb.Logger.Writer()
+		xgb.Logger.SetOutput(io.Discard)
+	}
+	quiet++
+	return func() {
+		loggerMu.Lock()
+		defer loggerMu.Unlock()
+		if quiet--; quiet == 0 {
+			xgb.Logger.SetOutput(output)
+		}
+	}
+}
+
+// readAuthority return the MIT-MAGIC-COOKIE-1 of the display number of the
+// server at address from the Xauthority file
+func readAuthority(file string, family uint16, address []byte, number string) ([]byte, error) {
+	if file == "" {
+		file = os.Getenv("XAUTHORITY")
+	}
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		file = home + "/.Xauthority"
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	for {
+		var entryFamily uint16
+		if err = binary.Read(r, binary.BigEndian, &entryFamily); err != nil {
+			return nil, errors.New("no authority for display " + number)
+		}
+		var fields [4][]byte
+		for i := range fields {
+			if fields[i], err = readCounted(r); err != nil {
+				return nil, err
+			}
+		}
+		addr, disp, name, cookie := fields[0], string(fields[1]), string(fields[2]), fields[3]
+		if entryFamily != familyWild && (entryFamily != family || !bytes.Equal(addr, address)) {
+			continue
+		}
+		if disp != "" && disp != number || name != authName || len(cookie) != 16 {
+			continue
+		}
+		return cookie, nil
+	}
+}
+
+// readCounted read a byte string prefixed by its 16 bits length
+func readCounted(r io.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+// authConn replace the authorization of the connection setup written by
+// xgb, which only reads the authority of $DISPLAY, by data
+type authConn struct {
+	net.Conn
+	data  []byte
+	setup bool
+	// xgb connection over the socket, known once the setup is done
+	xgb *xgb.Conn
+}
+
+// Close close the socket and forget it, xgb calls it once shut down
+func (c *authConn) Close() error {
+	socketsMu.Lock()
+	if c.xgb != nil {
+		delete(sockets, c.xgb)
+	}
+	socketsMu.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *authConn) Write(b []byte) (int, error) {
+	if c.setup {
+		return c.Conn.Write(b)
+	}
+	c.setup = true
+	if _, err := c.Conn.Write(setupRequest(c.data)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// setupRequest build the connection setup of protocol 11.0 in little
+// endian with the MIT-MAGIC-COOKIE-1 data, without authorization if data
+// is empty
+func setupRequest(data []byte) []byte {
+	name := authName
+	if len(data) == 0 {
+		name = ""
+	}
+	buf := make([]byte, 12+xgb.Pad(len(name))+xgb.Pad(len(data)))
+	buf[0] = 'l'
+	xgb.Put16(buf[2:], 11)
+	xgb.Put16(buf[4:], 0)
+	xgb.Put16(buf[6:], uint16(len(name)))
+	xgb.Put16(buf[8:], uint16(len(data)))
+	copy(buf[12:], name)
+	copy(buf[12+xgb.Pad(len(name)):], data)
+	return buf
+}
@@ -0,0 +1,97 @@
+package xconn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jezek/xgb"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want Display
+	}{
+		{":1", Display{Number: 1}},
+		{":3.1", Display{Number: 3, Screen: 1}},
+		{"unix:2", Display{Protocol: "unix", Number: 2}},
+		{"host:2.1", Display{Host: "host", Number: 2, Screen: 1}},
+		{"tcp/host:0", Display{Protocol: "tcp", Host: "host"}},
+		{"inet6/[::1]:1", Display{Protocol: "inet6", Host: "::1", Number: 1}},
+		{"/tmp/launch-1/org.x:0", Display{Socket: "/tmp/launch-1/org.x:0"}},
+	} {
+		got, err := Parse(tt.name)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	for _, name := range []string{"nocolon", ":", ":x", ":1.x", ":-1"} {
+		if _, err := Parse(name); err == nil {
+			t.Fatalf("%s: no error", name)
+		}
+	}
+}
+
+func TestReadAuthority(t *testing.T) {
+	var file bytes.Buffer
+	entry := func(family uint16, addr, disp, name string, data []byte) {
+		_ = binary.Write(&file, binary.BigEndian, family)
+		for _, field := range [][]byte{[]byte(addr), []byte(disp), []byte(name), data} {
+			_ = binary.Write(&file, binary.BigEndian, uint16(len(field)))
+			file.Write(field)
+		}
+	}
+	cookie := bytes.Repeat([]byte{7}, 16)
+	entry(familyLocal, "box", "1", authName, bytes.Repeat([]byte{1}, 16))
+	entry(familyLocal, "other", "3", authName, bytes.Repeat([]byte{2}, 16))
+	entry(familyLocal, "box", "3", "XDM-AUTHORIZATION-1", bytes.Repeat([]byte{3}, 16))
+	entry(familyLocal, "box", "3", authName, cookie)
+	path := filepath.Join(t.TempDir(), "Xauthority")
+	if err := os.WriteFile(path, file.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readAuthority(path, familyLocal, []byte("box"), "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, cookie) {
+		t.Fatalf("cookie %v", data)
+	}
+	if _, err = readAuthority(path, familyLocal, []byte("box"), "4"); err == nil {
+		t.Fatal("cookie found for display 4")
+	}
+}
+
+func TestSetupRequest(t *testing.T) {
+	buf := setupRequest(bytes.Repeat([]byte{7}, 16))
+	if len(buf) != 12+20+16 || buf[0] != 'l' || buf[6] != 18 || buf[8] != 16 {
+		t.Fatalf("setup %v", buf)
+	}
+	if buf := setupRequest(nil); len(buf) != 12 || buf[6] != 0 {
+		t.Fatalf("setup without authorization %v", buf)
+	}
+}
+
+func TestQuietLogger(t *testing.T) {
+	var buf bytes.Buffer
+	previous := xgb.Logger.Writer()
+	xgb.Logger.SetOutput(&buf)
+	defer xgb.Logger.SetOutput(previous)
+	restore := quietLogger()
+	inner := quietLogger()
+	xgb.Logger.Print("setup")
+	inner()
+	xgb.Logger.Print("setup")
+	restore()
+	xgb.Logger.Print("after")
+	if s := buf.String(); strings.Contains(s, "setup") || !strings.Contains(s, "after") {
+		t.Fatalf("logged %q", s)
+	}
+}
@@ -1,6 +1,10 @@
 package dcap
 
-import "github.com/diiyw/dcap/internal/keycode"
+import (
+	"context"
+
+	"github.com/diiyw/dcap/internal/keycode"
+)
 
 // https://github.com/go-vgo/robotgo/blob/master/key/goKey.h#L142
 func checkKeycodes(key string) int {
@@ -9,3 +13,25 @@ func checkKeycodes(key string) int {
 	}
 	return keycode.Maps[key]
 }
+
+// ToggleKey toggle keyboard event, keys left down are released by Close
+func (d *DCap) ToggleKey(key string, down bool) error {
+	return d.toggleKeyContext(context.Background(), key, down)
+}
+
+// toggleKeyContext ToggleKey once inputMu is taken, unless ctx is done
+// first
+func (d *DCap) toggleKeyContext(ctx context.Context, key string, down bool) error {
+	if err := d.checkOpen("toggle key"); err != nil {
+		return err
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.inputMu.Unlock()
+	if err := d.toggleKey(key, down); err != nil {
+		return err
+	}
+	d.held.key(key, down)
+	return nil
+}
@@ -1,5 +1,7 @@
 package dcap
 
+import "context"
+
 // MouseButton button of mouse
 type MouseButton byte
 
@@ -11,3 +13,26 @@ const (
 	// MouseRight right button for mouse
 	MouseRight
 )
+
+// ToggleMouse toggle mouse button event, buttons left down are released
+// by Close
+func (d *DCap) ToggleMouse(button MouseButton, down bool) error {
+	return d.toggleMouseContext(context.Background(), button, down)
+}
+
+// toggleMouseContext ToggleMouse once inputMu is taken, unless ctx is done
+// first
+func (d *DCap) toggleMouseContext(ctx context.Context, button MouseButton, down bool) error {
+	if err := d.checkOpen("toggle mouse"); err != nil {
+		return err
+	}
+	if err := d.inputMu.lock(ctx); err != nil {
+		return err
+	}
+	defer d.inputMu.Unlock()
+	if err := d.toggleMouse(button, down); err != nil {
+		return err
+	}
+	d.held.mouse(button, down)
+	return nil
+}
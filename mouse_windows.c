@@ -1,14 +1,15 @@
 #include "mouse_windows.h"
 
-void mouse_move(uint32_t x, uint32_t y) {
-    #define MOUSE_COORD_TO_ABS(coord, width_or_height) ( \
-        ((65536 * coord) / width_or_height) + (coord < 0 ? -1 : 1))
+void mouse_move(int32_t x, int32_t y) {
+    // absolute coordinates are normalized to 0..65535 over the virtual desktop
+    #define MOUSE_COORD_TO_ABS(coord, origin, width_or_height) ( \
+        ((65535 * ((coord) - (origin))) / ((width_or_height) - 1)))
 
     INPUT mouseInput;
     mouseInput.type = INPUT_MOUSE;
-    mouseInput.mi.dx = MOUSE_COORD_TO_ABS(x, GetSystemMetrics(SM_CXSCREEN));
-    mouseInput.mi.dy = MOUSE_COORD_TO_ABS(y, GetSystemMetrics(SM_CYSCREEN));
-    mouseInput.mi.dwFlags = MOUSEEVENTF_ABSOLUTE | MOUSEEVENTF_MOVE;
+    mouseInput.mi.dx = MOUSE_COORD_TO_ABS(x, GetSystemMetrics(SM_XVIRTUALSCREEN), GetSystemMetrics(SM_CXVIRTUALSCREEN));
+    mouseInput.mi.dy = MOUSE_COORD_TO_ABS(y, GetSystemMetrics(SM_YVIRTUALSCREEN), GetSystemMetrics(SM_CYVIRTUALSCREEN));
+    mouseInput.mi.dwFlags = MOUSEEVENTF_ABSOLUTE | MOUSEEVENTF_MOVE | MOUSEEVENTF_VIRTUALDESK;
     mouseInput.mi.time = 0;
     mouseInput.mi.dwExtraInfo = 0;
     mouseInput.mi.mouseData = 0;
@@ -5,7 +5,7 @@
 #include <stdint.h>
 #include <stdbool.h>
 
-void mouse_move(uint32_t x, uint32_t y);
+void mouse_move(int32_t x, int32_t y);
 void mouse_toggle(uint32_t button, bool down);
 void scroll(uint32_t x, uint32_t y);
 
@@ -0,0 +1,140 @@
+package dcap
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// Filter resampling filter of CaptureScaled
+type Filter int
+
+const (
+	// Nearest take the closest pixel, the fastest
+	Nearest Filter = iota
+	// Box average the pixels covered by the destination pixel, the best
+	// for large reductions
+	Box
+	// Bilinear interpolate the four closest pixels
+	Bilinear
+)
+
+// CaptureScaled capture rect of the virtual desktop scaled to width x
+// height, resampling is done while converting so no full size image is
+// created
+func (d *DCap) CaptureScaled(rect image.Rectangle, width, height int, filter Filter) (*image.RGBA, error) {
+	return d.captureScaledContext(context.Background(), rect, width, height, filter)
+}
+
+// captureScaledContext CaptureScaled once captureMu is taken, unless ctx is
+// done first
+func (d *DCap) captureScaledContext(ctx context.Context, rect image.Rectangle, width, height int, filter Filter) (*image.RGBA, error) {
+	if err := checkSize(width, height); err != nil {
+		return nil, err
+	}
+	if err := checkSize(rect.Dx(), rect.Dy()); err != nil {
+		return nil, err
+	}
+	if filter < Nearest || filter > Bilinear {
+		return nil, fmt.Errorf("%w: filter %d", ErrUnsupported, filter)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if err := d.captureMu.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer d.captureMu.Unlock()
+	err := d.captureRaw(rect, func(off image.Point, src pixels) {
+		scalePixels(dst, rect.Size(), off, src, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// scalePixels resample src, a block at off of a source of size, into dst,
+// only the pixels of dst whose centre falls in the block are written
+func scalePixels(dst *image.RGBA, size, off image.Point, src pixels, filter Filter) {
+	w, h := dst.Rect.Dx(), dst.Rect.Dy()
+	// destination pixels whose centre (2d+1)*size/2w is in the block
+	x0, x1 := scaleSpan(off.X, off.X+src.size.X, size.X, w)
+	y0, y1 := scaleSpan(off.Y, off.Y+src.size.Y, size.Y, h)
+	for dy := y0; dy < y1; dy++ {
+		i := dst.PixOffset(dst.Rect.Min.X+x0, dst.Rect.Min.Y+dy)
+		for dx := x0; dx < x1; dx++ {
+			var r, g, b uint8
+			switch filter {
+			case Nearest:
+				r, g, b = src.rgb((2*dx+1)*size.X/(2*w)-off.X, (2*dy+1)*size.Y/(2*h)-off.Y)
+			case Box:
+				r, g, b = boxSample(src,
+					dx*size.X/w-off.X, ((dx+1)*size.X+w-1)/w-off.X,
+					dy*size.Y/h-off.Y, ((dy+1)*size.Y+h-1)/h-off.Y)
+			case Bilinear:
+				r, g, b = bilinearSample(src,
+					float64(size.X)*(float64(dx)+0.5)/float64(w)-0.5-float64(off.X),
+					float64(size.Y)*(float64(dy)+0.5)/float64(h)-0.5-float64(off.Y))
+			}
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = r, g, b, 255
+			i += 4
+		}
+	}
+}
+
+// scaleSpan return the destination pixels [d0, d1) out of n whose centre
+// falls in [s0, s1) of a source of size
+func scaleSpan(s0, s1, size, n int) (d0, d1 int) {
+	// smallest d with (2d+1)*size/2n >= s, i.e. (2d+1)*size >= 2n*s
+	first := func(s int) int {
+		d := (2*n*s - size + 2*size - 1) / (2 * size)
+		if d < 0 {
+			d = 0
+		}
+		return d
+	}
+	return min(first(s0), n), min(first(s1), n)
+}
+
+// boxSample average the pixels of [x0, x1) x [y0, y1) clipped to src
+func boxSample(src pixels, x0, x1, y0, y1 int) (r, g, b uint8) {
+	x0, y0 = max(x0, 0), max(y0, 0)
+	x1, y1 = min(x1, src.size.X), min(y1, src.size.Y)
+	var sr, sg, sb, n int
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			pr, pg, pb := src.rgb(x, y)
+			sr, sg, sb, n = sr+int(pr), sg+int(pg), sb+int(pb), n+1
+		}
+	}
+	if n == 0 {
+		return 0, 0, 0
+	}
+	return uint8((sr + n/2) / n), uint8((sg + n/2) / n), uint8((sb + n/2) / n)
+}
+
+// bilinearSample interpolate src at x, y, clamped to its edges
+func bilinearSample(src pixels, x, y float64) (r, g, b uint8) {
+	clamp := func(v float64, n int) (int, int, float64) {
+		if v <= 0 {
+			return 0, 0, 0
+		}
+		if v >= float64(n-1) {
+			return n - 1, n - 1, 0
+		}
+		i := int(v)
+		return i, i + 1, v - float64(i)
+	}
+	x0, x1, fx := clamp(x, src.size.X)
+	y0, y1, fy := clamp(y, src.size.Y)
+	lerp := func(a, b uint8, f float64) float64 {
+		return float64(a) + (float64(b)-float64(a))*f
+	}
+	r00, g00, b00 := src.rgb(x0, y0)
+	r10, g10, b10 := src.rgb(x1, y0)
+	r01, g01, b01 := src.rgb(x0, y1)
+	r11, g11, b11 := src.rgb(x1, y1)
+	mix := func(c00, c10, c01, c11 uint8) uint8 {
+		return uint8(lerp(c00, c10, fx)*(1-fy) + lerp(c01, c11, fx)*fy + 0.5)
+	}
+	return mix(r00, r10, r01, r11), mix(g00, g10, g01, g11), mix(b00, b10, b01, b11)
+}
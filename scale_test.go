@@ -0,0 +1,66 @@
+package dcap
+
+import (
+	"image"
+	"testing"
+)
+
+// gradient BGRA pixels of size, red is x and green is y
+func gradient(size image.Point) pixels {
+	p := pixels{pix: make([]byte, size.X*size.Y*4), stride: size.X * 4, size: size}
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			i := y*p.stride + x*4
+			p.pix[i+2], p.pix[i+1] = uint8(x), uint8(y)
+		}
+	}
+	return p
+}
+
+func TestScalePixels(t *testing.T) {
+	size := image.Pt(8, 4)
+	src := gradient(size)
+	for _, tt := range []struct {
+		filter Filter
+		// red of the first two pixels of the first row
+		r0, r1 uint8
+	}{
+		{Nearest, 1, 3},
+		{Box, 1, 3}, // average of 0,1 and 2,3 rounded
+		{Bilinear, 1, 3},
+	} {
+		dst := image.NewRGBA(image.Rect(0, 0, 4, 2))
+		scalePixels(dst, size, image.Point{}, src, tt.filter)
+		if c := dst.RGBAAt(0, 0); c.R != tt.r0 || c.A != 255 {
+			t.Fatalf("filter %d pixel 0,0 = %v", tt.filter, c)
+		}
+		if c := dst.RGBAAt(1, 0); c.R != tt.r1 {
+			t.Fatalf("filter %d pixel 1,0 = %v", tt.filter, c)
+		}
+		if c := dst.RGBAAt(3, 1); c.A != 255 {
+			t.Fatalf("filter %d pixel 3,1 not written", tt.filter)
+		}
+	}
+}
+
+func TestScalePixelsBlocks(t *testing.T) {
+	// a source split in two blocks writes every destination pixel once
+	size := image.Pt(10, 6)
+	full := gradient(size)
+	whole := image.NewRGBA(image.Rect(0, 0, 3, 4))
+	scalePixels(whole, size, image.Point{}, full, Nearest)
+
+	split := image.NewRGBA(image.Rect(0, 0, 3, 4))
+	left := full
+	left.size = image.Pt(4, 6)
+	right := full
+	right.pix = full.pix[16:]
+	right.size = image.Pt(6, 6)
+	scalePixels(split, size, image.Point{}, left, Nearest)
+	scalePixels(split, size, image.Pt(4, 0), right, Nearest)
+	for i := range whole.Pix {
+		if whole.Pix[i] != split.Pix[i] {
+			t.Fatalf("byte %d = %d, want %d", i, split.Pix[i], whole.Pix[i])
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package dcap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// XvfbOptions configure NewXvfbSession
+type XvfbOptions struct {
+	// Screens size of each X screen, one 1920x1080 screen when empty
+	Screens []image.Point
+	// Depth colour depth of the screens, 24 by default
+	Depth int
+	// Extensions extensions enabled with +extension, e.g. RANDR or
+	// MIT-SHM
+	Extensions []string
+	// DisabledExtensions extensions disabled with -extension, e.g. XTEST,
+	// XINERAMA or RANDR, to test a degraded server
+	DisabledExtensions []string
+	// Xephyr run Xephyr nested in the current display instead of Xvfb
+	Xephyr bool
+	// Timeout time allowed for the server to accept connections, 10
+	// seconds by default
+	Timeout time.Duration
+	// Options options of the DCap of the session
+	Options []Option
+}
+
+// XvfbSession X server started for tests and a DCap connected to it
+type XvfbSession struct {
+	*DCap
+	// Display name of the display of the server, e.g. :99
+	Display string
+
+	server    *xserver
+	closeOnce sync.Once
+}
+
+// xserver process of the X server of a session
+type xserver struct {
+	cmd *exec.Cmd
+	// exited is closed once the server exited with err
+	exited chan struct{}
+	err    error
+	// stopOnce signals and waits for the server on the first stop
+	stopOnce sync.Once
+}
+
+// startServer start cmd and wait for its exit in the background
+func startServer(cmd *exec.Cmd) (*xserver, error) {
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	x := &xserver{cmd: cmd, exited: make(chan struct{})}
+	go func() {
+		x.err = cmd.Wait()
+		close(x.exited)
+	}()
+	return x, nil
+}
+
+// stop terminate the server and wait for it, later calls return the same
+// error at once
+func (x *xserver) stop() error {
+	x.stopOnce.Do(func() {
+		_ = x.cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-x.exited:
+		case <-time.After(5 * time.Second):
+			_ = x.cmd.Process.Kill()
+			<-x.exited
+		}
+	})
+	var exit *exec.ExitError
+	if errors.As(x.err, &exit) && exit.Sys().(syscall.WaitStatus).Signaled() {
+		// killed by our signal
+		return nil
+	}
+	return x.err
+}
+
+// NewXvfbSession start Xvfb on a free display number and connect a DCap to
+// it once it accepts connections, Close stops both
+func NewXvfbSession(opts XvfbOptions) (*XvfbSession, error) {
+	program := "Xvfb"
+	if opts.Xephyr {
+		program = "Xephyr"
+	}
+	path, err := exec.LookPath(program)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if len(opts.Screens) == 0 {
+		opts.Screens = []image.Point{{X: 1920, Y: 1080}}
+	}
+	if opts.Depth == 0 {
+		opts.Depth = 24
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	// the server picks a free display and writes its number to fd 3 once
+	// it is ready
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	args := []string{"-displayfd", "3", "-nolisten", "tcp"}
+	for i, size := range opts.Screens {
+		if opts.Xephyr {
+			args = append(args, "-screen", fmt.Sprintf("%dx%dx%d", size.X, size.Y, opts.Depth))
+			continue
+		}
+		args = append(args, "-screen", fmt.Sprint(i), fmt.Sprintf("%dx%dx%d", size.X, size.Y, opts.Depth))
+	}
+	for _, ext := range opts.Extensions {
+		args = append(args, "+extension", ext)
+	}
+	for _, ext := range opts.DisabledExtensions {
+		args = append(args, "-extension", ext)
+	}
+	cmd := exec.Command(path, args...)
+	cmd.ExtraFiles = []*os.File{w}
+	// the server must not outlive us when the test binary is killed
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	server, err := startServer(cmd)
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+	s := &XvfbSession{server: server}
+
+	display := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		display <- strings.TrimSpace(line)
+	}()
+	select {
+	case number := <-display:
+		if number == "" {
+			server.stop()
+			return nil, fmt.Errorf("%s exited before accepting connections", program)
+		}
+		s.Display = ":" + number
+	case <-time.After(opts.Timeout):
+		server.stop()
+		return nil, fmt.Errorf("%s not ready after %v", program, opts.Timeout)
+	}
+
+	s.DCap, err = NewDCapWithOptions(append([]Option{WithDisplay(s.Display)}, opts.Options...)...)
+	if err != nil {
+		server.stop()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close close the DCap and stop the server, later calls do nothing
+func (s *XvfbSession) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = errors.Join(s.DCap.Close(), s.server.stop())
+	})
+	return err
+}
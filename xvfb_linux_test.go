@@ -0,0 +1,385 @@
+package dcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/randr"
+	"github.com/jezek/xgb/xproto"
+)
+
+// TestMain run the X tests on a private Xvfb when there is no desktop
+func TestMain(m *testing.M) {
+	var s *XvfbSession
+	if _, err := exec.LookPath("Xvfb"); err == nil && os.Getenv("DISPLAY") == "" {
+		s, err = NewXvfbSession(XvfbOptions{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Setenv("DISPLAY", s.Display)
+		privateXvfb = true
+	}
+	code := m.Run()
+	if s != nil {
+		_ = s.Close()
+	}
+	os.Exit(code)
+}
+
+func TestXvfbSession(t *testing.T) {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{Screens: []image.Point{{X: 800, Y: 600}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Displays) != 1 || s.Displays[0] != image.Rect(0, 0, 800, 600) {
+		t.Fatalf("displays %v", s.Displays)
+	}
+	if err = s.Capture(0, 0, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the server is gone, a second Close must not wait for it
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Close()
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second Close blocked")
+	}
+}
+
+func TestXvfbDisabledExtensions(t *testing.T) {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{
+		Screens:            []image.Point{{X: 800, Y: 600}},
+		DisabledExtensions: []string{"XTEST", "MIT-SHM", "DAMAGE", "RANDR", "XINERAMA"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	caps := s.Capabilities()
+	if !caps.Capture || caps.Input || caps.Shm || caps.Damage {
+		t.Fatalf("capabilities %+v", caps)
+	}
+	// the displays fall back to the root window
+	if len(s.Displays) != 1 || s.Displays[0] != image.Rect(0, 0, 800, 600) {
+		t.Fatalf("displays %v", s.Displays)
+	}
+	if err = s.Capture(0, 0, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ToggleMouse(MouseLeft, true); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("toggle mouse error %v, want %v", err, ErrUnsupported)
+	}
+	if err = s.ToggleKey("a", true); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("toggle key error %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestWithDisplay(t *testing.T) {
+	if _, err := NewDCapWithOptions(WithDisplay("nocolon")); err == nil {
+		t.Fatal("bad display name accepted")
+	}
+	if _, err := NewDCapWithOptions(WithDisplay(":4095"), WithXauthority(os.DevNull)); err == nil {
+		t.Fatal("connected to a missing display")
+	}
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{Screens: []image.Point{{X: 640, Y: 480}, {X: 320, Y: 240}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	d, err := NewDCapWithOptions(WithDisplay(s.Display), WithScreen(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.Displays[0] != image.Rect(0, 0, 320, 240) {
+		t.Fatalf("screen 1 displays %v", d.Displays)
+	}
+	if _, err = NewDCapWithOptions(WithDisplay(s.Display), WithScreen(2)); !errors.Is(err, ErrDisplayNotFound) {
+		t.Fatalf("missing screen error %v", err)
+	}
+}
+
+func TestScreens(t *testing.T) {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{Screens: []image.Point{{X: 640, Y: 480}, {X: 320, Y: 240}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	want := []image.Rectangle{image.Rect(0, 0, 640, 480), image.Rect(640, 0, 960, 240)}
+	if len(s.Displays) != 2 || s.Displays[0] != want[0] || s.Displays[1] != want[1] {
+		t.Fatalf("displays %v, want %v", s.Displays, want)
+	}
+	for i, display := range s.DisplayInfo() {
+		if display.Screen != i {
+			t.Fatalf("display %d on screen %d", i, display.Screen)
+		}
+	}
+	// a capture across both screens
+	if err = s.Capture(600, 0, 100, 100); err != nil {
+		t.Fatal(err)
+	}
+	frames, err := s.CaptureDisplays()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames[1].Image.Bounds().Size() != want[1].Size() {
+		t.Fatalf("frame of screen 1 %v", frames[1].Image.Bounds())
+	}
+	if err = s.MouseMove(700, 10); err != nil {
+		t.Fatal(err)
+	}
+	pointer, err := xproto.QueryPointer(s.xgbConn, s.screens[1].root).Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pointer.SameScreen || pointer.RootX != 60 || pointer.RootY != 10 {
+		t.Fatalf("pointer on screen 1 at %d,%d", pointer.RootX, pointer.RootY)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	path, err := exec.LookPath("Xvfb")
+	if err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{Options: []Option{WithReconnect(time.Second)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// wait skips the display events up to typ
+	wait := func(typ EventType) Event {
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case ev := <-s.Events():
+				if ev.Type == typ {
+					return ev
+				}
+			case <-timeout:
+				t.Fatalf("no %v event", typ)
+			}
+		}
+	}
+	if err = s.server.stop(); err != nil {
+		t.Fatal(err)
+	}
+	if ev := wait(ConnectionLost); !errors.Is(ev.Err, ErrConnectionLost) {
+		t.Fatalf("connection lost error %v", ev.Err)
+	}
+	if err = s.Capture(0, 0, 10, 10); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("capture error %v", err)
+	}
+
+	// restart the server on the same display
+	if s.server, err = startServer(exec.Command(path, s.Display, "-nolisten", "tcp")); err != nil {
+		t.Fatal(err)
+	}
+	wait(Reconnected)
+	if err = s.Capture(0, 0, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseHungServer(t *testing.T) {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// Close releases it on the hung server too
+	if err = s.ToggleMouse(MouseLeft, true); err != nil {
+		t.Fatal(err)
+	}
+	// the server stops answering, the capture holds its lock
+	if err = s.server.cmd.Process.Signal(syscall.SIGSTOP); err != nil {
+		t.Fatal(err)
+	}
+	defer s.server.cmd.Process.Signal(syscall.SIGCONT)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err = s.CaptureContext(ctx, 0, 0, 10, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("capture error %v", err)
+	}
+	closed := make(chan struct{})
+	go func() {
+		_ = s.DCap.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waits on the hung server")
+	}
+}
+
+// fillRect map a window of colour pixel over rect of root
+func fillRect(t *testing.T, c *xgb.Conn, root xproto.Window, rect image.Rectangle, pixel uint32) {
+	t.Helper()
+	screen := xproto.Setup(c).DefaultScreen(c)
+	win, err := xproto.NewWindowId(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = xproto.CreateWindowChecked(c, screen.RootDepth, win, root,
+		int16(rect.Min.X), int16(rect.Min.Y), uint16(rect.Dx()), uint16(rect.Dy()), 0,
+		xproto.WindowClassInputOutput, screen.RootVisual,
+		xproto.CwBackPixel|xproto.CwOverrideRedirect, []uint32{pixel, 1}).Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = xproto.MapWindowChecked(c, win).Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMonitorsNegativeOffset(t *testing.T) {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{Screens: []image.Point{{X: 960, Y: 480}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if !s.monitors {
+		t.Skip("RandR 1.5 monitors not supported")
+	}
+	// a primary monitor showing the output on the right of the root window
+	// and another one on its left, as set by xrandr --setmonitor
+	c, root := s.xgbConn, s.defaultScreen.Root
+	resources, err := randr.GetScreenResourcesCurrent(c, root).Reply()
+	if err != nil || len(resources.Outputs) == 0 {
+		t.Skip("no RandR output")
+	}
+	for _, m := range []struct {
+		name    string
+		primary bool
+		rect    image.Rectangle
+		outputs []randr.Output
+	}{
+		{"DCAP-LEFT", false, image.Rect(0, 0, 320, 240), nil},
+		{"DCAP-MAIN", true, image.Rect(320, 0, 960, 480), resources.Outputs[:1]},
+	} {
+		atom, err := xproto.InternAtom(c, false, uint16(len(m.name)), m.name).Reply()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = randr.SetMonitorChecked(c, root, randr.MonitorInfo{
+			Name:    atom.Atom,
+			Primary: m.primary,
+			X:       int16(m.rect.Min.X), Y: int16(m.rect.Min.Y),
+			Width: uint16(m.rect.Dx()), Height: uint16(m.rect.Dy()),
+			NOutput: uint16(len(m.outputs)),
+			Outputs: m.outputs,
+		}).Check()
+		if err != nil {
+			t.Skip("SetMonitor:", err)
+		}
+	}
+	// red square at 10,10 of the root window, in the left monitor
+	fillRect(t, c, root, image.Rect(10, 10, 20, 20), 0xff0000)
+
+	d, err := NewDCapWithOptions(WithDisplay(s.Display))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	want := []image.Rectangle{image.Rect(0, 0, 640, 480), image.Rect(-320, 0, 0, 240)}
+	if len(d.Displays) != 2 || d.Displays[0] != want[0] || d.Displays[1] != want[1] {
+		t.Fatalf("displays %v, want %v", d.Displays, want)
+	}
+	if err = d.Capture(-310, 10, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+	if px := d.Image().RGBAAt(5, 5); px != (color.RGBA{R: 255, A: 255}) {
+		t.Fatalf("pixel at -305,15 is %v, want red", px)
+	}
+	if err = d.CaptureDisplay(1); err != nil {
+		t.Fatal(err)
+	}
+	if px := d.Image().RGBAAt(15, 15); px != (color.RGBA{R: 255, A: 255}) {
+		t.Fatalf("pixel 15,15 of display 1 is %v, want red", px)
+	}
+
+	if err = d.MouseMove(-300, 20); err != nil {
+		t.Fatal(err)
+	}
+	pointer, err := xproto.QueryPointer(c, root).Reply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pointer.RootX != 20 || pointer.RootY != 20 {
+		t.Fatalf("pointer at %d,%d of the root window, want 20,20", pointer.RootX, pointer.RootY)
+	}
+}
+
+func TestLeakReporterX11(t *testing.T) {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		t.Skip("Xvfb not installed")
+	}
+	s, err := NewXvfbSession(XvfbOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	leaks := make(chan string, 1)
+	SetLeakReporter(func(stack string) {
+		leaks <- stack
+	})
+	defer SetLeakReporter(nil)
+
+	// the event loop of the connection does not keep the DCap alive
+	func() {
+		_, err = NewDCapWithOptions(WithDisplay(s.Display))
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case <-leaks:
+			return
+		case <-timeout:
+			t.Fatal("leaked DCap not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}